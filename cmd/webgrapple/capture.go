@@ -0,0 +1,52 @@
+package webgrapple
+
+import (
+	"github.com/foomo/webgrapple/pkg/server"
+	"github.com/foomo/webgrapple/pkg/utils"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	captureCmd = &cobra.Command{
+		Use:   "capture",
+		Short: "control HAR captures of a running reverse proxy",
+	}
+	captureStartCmd = &cobra.Command{
+		Use:   "start",
+		Short: "start recording proxied traffic",
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := utils.GetLogger()
+			client := server.NewServiceGoTSRPCClient(flagReverseProxyURL, server.DefaultEndPoint)
+			errStart, errClient := client.StartCapture(cmd.Context())
+			if errClient != nil {
+				logger.Fatal("could not reach reverse proxy", zap.Error(errClient))
+			}
+			if errStart != nil {
+				logger.Fatal("could not start capture", zap.Error(errStart))
+			}
+			logger.Info("capturing")
+		},
+	}
+	captureStopCmd = &cobra.Command{
+		Use:   "stop",
+		Short: "stop recording and write the HAR file",
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := utils.GetLogger()
+			client := server.NewServiceGoTSRPCClient(flagReverseProxyURL, server.DefaultEndPoint)
+			file, errStop, errClient := client.StopCapture(cmd.Context())
+			if errClient != nil {
+				logger.Fatal("could not reach reverse proxy", zap.Error(errClient))
+			}
+			if errStop != nil {
+				logger.Fatal("could not stop capture", zap.Error(errStop))
+			}
+			logger.Info("wrote capture", zap.String("file", file))
+		},
+	}
+)
+
+func init() {
+	captureCmd.PersistentFlags().StringVar(&flagReverseProxyURL, "reverse-proxy-url", flagReverseProxyURL, "reverse proxy url")
+	captureCmd.AddCommand(captureStartCmd, captureStopCmd)
+}
@@ -0,0 +1,128 @@
+package webgrapple
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/foomo/webgrapple/pkg/certs"
+	"github.com/foomo/webgrapple/pkg/truststore"
+	"github.com/foomo/webgrapple/pkg/utils"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	flagTrustSkipSystem          = false
+	flagTrustSystemAnchorsDir    = ""
+	flagTrustSystemUpdateCommand = ""
+	flagTrustSkipNSS             = false
+	flagTrustNSSDBs              = []string{}
+	flagTrustCertutil            = ""
+
+	certCmd = &cobra.Command{
+		Use:   "cert",
+		Short: "manage the local CA, that signs the reverse proxy certificates",
+	}
+	certInspectCmd = &cobra.Command{
+		Use:   "inspect [cert.pem...]",
+		Short: "print what certificates cover, inspects the local CA, if no files are given",
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := utils.GetLogger()
+			files := args
+			if len(files) == 0 {
+				caCertFile, _, _ := caFilesFromFlags(logger)
+				files = []string{caCertFile}
+			}
+			if errInspect := inspectCertificates(cmd.OutOrStdout(), files, time.Now()); errInspect != nil {
+				logger.Fatal("could not inspect certificates", zap.Error(errInspect))
+			}
+		},
+	}
+	certTrustCmd = &cobra.Command{
+		Use:   "trust",
+		Short: "install the local CA into the system trust store and the NSS databases of Firefox and Chromium",
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := utils.GetLogger()
+			caCertFile, _, local := caFilesFromFlags(logger)
+			if local {
+				ca, created, errCA := certs.LoadOrCreateCA(filepath.Dir(caCertFile))
+				if errCA != nil {
+					logger.Fatal("could not load local CA", zap.Error(errCA))
+				}
+				if created {
+					logger.Info("created local CA", zap.String("cert", ca.CertFile))
+				}
+			}
+			if errInstall := truststore.Install(logger.Sugar(), caCertFile, trustStoreConfigFromFlags(cmd)); errInstall != nil {
+				logger.Fatal("could not trust CA", zap.Error(errInstall))
+			}
+			logger.Info("CA is trusted, restart your browsers", zap.String("cert", caCertFile))
+		},
+	}
+	certUntrustCmd = &cobra.Command{
+		Use:   "untrust",
+		Short: "remove the local CA from the system trust store and the NSS databases of Firefox and Chromium",
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := utils.GetLogger()
+			caCertFile, _, _ := caFilesFromFlags(logger)
+			if errUninstall := truststore.Uninstall(logger.Sugar(), caCertFile, trustStoreConfigFromFlags(cmd)); errUninstall != nil {
+				logger.Fatal("could not untrust CA", zap.Error(errUninstall))
+			}
+			logger.Info("CA is not trusted anymore", zap.String("cert", caCertFile))
+		},
+	}
+)
+
+func inspectCertificates(w io.Writer, files []string, now time.Time) error {
+	for _, file := range files {
+		certificates, errRead := certs.ReadCertificates(file)
+		if errRead != nil {
+			return fmt.Errorf("could not read certificates from %q: %w", file, errRead)
+		}
+		for i, cert := range certificates {
+			fmt.Fprintf(w, "%s [%d]\n%s\n\n", file, i, certs.Describe(cert, now))
+		}
+	}
+	return nil
+}
+
+// caFilesFromFlags the CA the reverse proxy signs with for the same flags, CAROOT is honored like it does
+func caFilesFromFlags(logger *zap.Logger) (certFile, keyFile string, local bool) {
+	certFile, keyFile, local, errResolve := certs.ResolveCAFiles(flagCADir, flagCACert, flagCAKey)
+	if errResolve != nil {
+		logger.Fatal("could not find CA", zap.Error(errResolve))
+	}
+	return certFile, keyFile, local
+}
+
+func trustStoreConfigFromFlags(cmd *cobra.Command) truststore.Config {
+	config := truststore.Config{
+		SkipSystem:          flagTrustSkipSystem,
+		SystemAnchorsDir:    flagTrustSystemAnchorsDir,
+		SystemUpdateCommand: strings.Fields(flagTrustSystemUpdateCommand),
+		SkipNSS:             flagTrustSkipNSS,
+		Certutil:            flagTrustCertutil,
+	}
+	if cmd.Flags().Changed("nss-db") {
+		config.NSSDBs = flagTrustNSSDBs
+	}
+	return config
+}
+
+func init() {
+	for _, c := range []*cobra.Command{certTrustCmd, certUntrustCmd} {
+		c.Flags().BoolVar(&flagTrustSkipSystem, "skip-system", flagTrustSkipSystem, "do not touch the system trust store")
+		c.Flags().StringVar(&flagTrustSystemAnchorsDir, "system-anchors-dir", flagTrustSystemAnchorsDir, "system trust anchors dir, detected for update-ca-certificates and p11-kit layouts if empty")
+		c.Flags().StringVar(&flagTrustSystemUpdateCommand, "system-update-command", flagTrustSystemUpdateCommand, "command to refresh the system trust store, detected with the anchors dir if empty")
+		c.Flags().BoolVar(&flagTrustSkipNSS, "skip-nss", flagTrustSkipNSS, "do not touch NSS databases")
+		c.Flags().StringArrayVar(&flagTrustNSSDBs, "nss-db", flagTrustNSSDBs, "NSS database dir, Chromium and Firefox profiles are detected if not given")
+		c.Flags().StringVar(&flagTrustCertutil, "certutil", flagTrustCertutil, "path to the NSS certutil binary")
+	}
+	certCmd.PersistentFlags().StringVar(&flagCADir, "ca-dir", flagCADir, "directory of the local CA, defaults to webgrapple/ca in the user config dir")
+	certCmd.PersistentFlags().StringVar(&flagCACert, "ca-cert", flagCACert, "use this CA cert instead of the local CA, CAROOT of mkcert is used if set")
+	certCmd.PersistentFlags().StringVar(&flagCAKey, "ca-key", flagCAKey, "key of the CA given with --ca-cert")
+	certCmd.AddCommand(certInspectCmd, certTrustCmd, certUntrustCmd)
+}
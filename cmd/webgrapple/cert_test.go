@@ -0,0 +1,48 @@
+package webgrapple
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/foomo/webgrapple/pkg/certs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectCertificates(t *testing.T) {
+	dir := t.TempDir()
+	ca, _, errCA := certs.LoadOrCreateCA(dir)
+	require.NoError(t, errCA)
+	certPEM, keyPEM, errIssue := ca.Issue([]string{"webgrapple.test"}, certs.LeafConfig{KeyType: certs.KeyTypeEd25519})
+	require.NoError(t, errIssue)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, certs.WriteCertAndKey(certFile, keyFile, certPEM, keyPEM))
+
+	out := &bytes.Buffer{}
+	require.NoError(t, inspectCertificates(out, []string{certFile, ca.CertFile}, time.Now()))
+	assert.Contains(t, out.String(), certFile+" [0]\nsubject:      CN=webgrapple.test,O=webgrapple\n")
+	assert.Contains(t, out.String(), "key:          Ed25519\n")
+	assert.Contains(t, out.String(), ca.CertFile+" [0]\nsubject:      CN=webgrapple ")
+	assert.Contains(t, out.String(), "ca:           true\n")
+
+	for _, test := range []struct {
+		name    string
+		file    string
+		wantErr string
+	}{
+		{name: "missing", file: filepath.Join(dir, "missing.pem"), wantErr: "no such file"},
+		{name: "key only", file: keyFile, wantErr: "no certificates found"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			errInspect := inspectCertificates(out, []string{certFile, test.file}, time.Now())
+			require.Error(t, errInspect)
+			assert.Contains(t, errInspect.Error(), test.file)
+			assert.Contains(t, errInspect.Error(), test.wantErr)
+			// what was read before is still printed
+			assert.Contains(t, out.String(), certFile+" [0]")
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package webgrapple
+
+import (
+	"errors"
+	"os"
+
+	"github.com/foomo/webgrapple/pkg/clientexec"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/foomo/webgrapple/pkg/utils"
+)
+
+var (
+	flagRestart             = string(clientexec.RestartNever)
+	flagRestartMax          = clientexec.DefaultSupervisorConfig().MaxRestarts
+	flagRestartWindow       = clientexec.DefaultSupervisorConfig().CrashLoopWindow
+	flagRestartBackoffMax   = clientexec.DefaultSupervisorConfig().MaxBackoff
+	flagRestartingPage      = false
+	flagGracePeriod         = clientexec.DefaultGracePeriod
+	flagExecEnv             = []string{}
+	flagExecServiceIDPrefix = "exec-service-"
+	flagPublicURL           = clientexec.DefaultPublicURL
+	clientExecCmd           = &cobra.Command{
+		Use:   "client-exec [flags] [-- command [args...]]",
+		Short: "client to hook up any local dev server",
+		Long: `allows you to webgrapple a dev server written in any language
+
+- client-exec assumes that your server will respond on http://127.0.0.1:<port>
+- the port is passed in the env var PORT
+- without a command all services from webgrapple.yaml are started with their own command, dir and env
+- envFiles and env of services are loaded, ${VAR} references in them are expanded
+- WEBGRAPPLE_PUBLIC_URL, WEBGRAPPLE_SERVICE_ID, WEBGRAPPLE_SERVICE_URL and NODE_EXTRA_CA_CERTS are set
+- when files matching the watch globs of services change, the command is restarted
+
+		`,
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := utils.GetLogger()
+			wd, errWd := os.Getwd()
+			if errWd != nil {
+				logger.Error("could not determine working directory", zap.Error(errWd))
+				return
+			}
+			supervisorConfig, errSupervisorConfig := supervisorConfigFromFlags()
+			if errSupervisorConfig != nil {
+				logger.Error("invalid restart flags", zap.Error(errSupervisorConfig))
+				return
+			}
+			opts := []clientexec.Option{
+				clientexec.WithPort(flagPort),
+				clientexec.WithConfigPath(flagConfigPath),
+				clientexec.WithEnv(flagExecEnv...),
+				clientexec.WithServiceIDPrefix(flagExecServiceIDPrefix),
+				clientexec.WithReadyTimeout(flagReadyTimeout),
+				clientexec.WithHealthPath(flagHealthPath),
+				clientexec.WithSupervisor(supervisorConfig),
+				clientexec.WithGracePeriod(flagGracePeriod),
+				clientexec.WithPublicURL(flagPublicURL),
+				clientexec.WithCACertFile(flagCACert),
+			}
+			var errRun error
+			if len(args) == 0 {
+				errRun = clientexec.RunServices(cmd.Context(), logger.Sugar(), flagReverseProxyURL, wd, opts...)
+			} else {
+				errRun = clientexec.Run(cmd.Context(), logger.Sugar(), flagReverseProxyURL, wd, args[0], args[1:], opts...)
+			}
+			if errRun != nil {
+				logger.Error("run failed", zap.String("error", errRun.Error()))
+			}
+			logger.Info("shutting down")
+			exitWithCommandCode(errRun)
+		},
+	}
+)
+
+func supervisorConfigFromFlags() (clientexec.SupervisorConfig, error) {
+	config := clientexec.DefaultSupervisorConfig()
+	policy, errPolicy := clientexec.ParseRestartPolicy(flagRestart)
+	if errPolicy != nil {
+		return config, errPolicy
+	}
+	config.Policy = policy
+	config.MaxRestarts = flagRestartMax
+	config.CrashLoopWindow = flagRestartWindow
+	config.MaxBackoff = flagRestartBackoffMax
+	config.RestartingPage = flagRestartingPage
+	return config, nil
+}
+
+// exitWithCommandCode exit with the exit code of a failed command
+func exitWithCommandCode(errRun error) {
+	var errExit *clientexec.ExitError
+	if errors.As(errRun, &errExit) {
+		os.Exit(errExit.Code)
+	}
+}
+
+// addEnvFlags flags for what webgrapple passes to the commands of the clients
+func addEnvFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&flagPublicURL, "public-url", flagPublicURL, "public url of the reverse proxy, passed in WEBGRAPPLE_PUBLIC_URL")
+	cmd.Flags().StringVar(&flagCACert, "ca-cert", flagCACert, "CA cert passed in NODE_EXTRA_CA_CERTS, defaults to the local webgrapple CA")
+}
+
+// addSupervisorFlags restart and shutdown flags are shared by the clients
+func addSupervisorFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&flagRestart, "restart", flagRestart, "restart policy, when the command exits: never, on-failure or always")
+	cmd.Flags().IntVar(&flagRestartMax, "restart-max", flagRestartMax, "give up after this many restarts within --restart-window, 0 restarts forever")
+	cmd.Flags().DurationVar(&flagRestartWindow, "restart-window", flagRestartWindow, "window for counting restarts to detect a crash loop")
+	cmd.Flags().DurationVar(&flagRestartBackoffMax, "restart-backoff-max", flagRestartBackoffMax, "maximum delay between restarts, the delay doubles with every quick crash")
+	cmd.Flags().DurationVar(&flagGracePeriod, "grace-period", flagGracePeriod, "how long the command may take to terminate after SIGTERM, before it is killed")
+	cmd.Flags().BoolVar(&flagRestartingPage, "restarting-page", flagRestartingPage, "let the proxy serve a \"restarting\" page, while the command restarts")
+}
+
+func init() {
+	addSupervisorFlags(clientExecCmd)
+	addEnvFlags(clientExecCmd)
+	clientExecCmd.Flags().StringVar(&flagReverseProxyURL, "reverse-proxy-url", flagReverseProxyURL, "reverse proxy url")
+	clientExecCmd.Flags().StringVar(&flagConfigPath, "config", flagConfigPath, "path to webgrapple.yaml")
+	clientExecCmd.Flags().IntVar(&flagPort, "port", flagPort, "which port to use, if 0 client-exec will look for a free port, either way env PORT will be set")
+	clientExecCmd.Flags().DurationVar(&flagReadyTimeout, "ready-timeout", flagReadyTimeout, "how long to wait for the server to listen, services are registered with the proxy once it does")
+	clientExecCmd.Flags().StringVar(&flagHealthPath, "health-path", flagHealthPath, "http path to check, if a service is ready, for services without healthPath, by default a tcp connect is enough")
+	clientExecCmd.Flags().StringArrayVar(&flagExecEnv, "env", flagExecEnv, "additional env vars for the command NAME=value")
+	clientExecCmd.Flags().StringVar(&flagExecServiceIDPrefix, "service-id-prefix", flagExecServiceIDPrefix, "prefix for service ids, that are not set in webgrapple.yaml, the directory name is appended")
+}
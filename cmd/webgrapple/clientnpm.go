@@ -2,7 +2,9 @@ package webgrapple
 
 import (
 	"os"
+	"path/filepath"
 
+	"github.com/foomo/webgrapple/pkg/clientexec"
 	"github.com/foomo/webgrapple/pkg/clientnpm"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
@@ -14,15 +16,22 @@ import (
 var (
 	flagDebugServerPort = 0
 	flagStartVSCode     = false
+	flagDebugJetBrains  = false
 	flagReverseProxyURL = server.DefaultServiceURL
 	flagConfigPath      = ""
+	flagReadyTimeout    = clientexec.DefaultReadyTimeout
+	flagHealthPath      = ""
 	// Command use this for NPM support, when composing your own webgrapple
 	clientNPMCmd = &cobra.Command{
-		Use:   "client-npm",
+		Use:   "client-npm [flags] [script | command] [args...]",
 		Short: "client to hook up a npm / Node.js server",
 		Long: `allows you to webgrapple a Node.js server and has debugging support for vscode
 
 - client-npm assumes that your Node.js server will respond on http://127.0.0.1:<flagPort>
+- the package manager (npm, yarn, pnpm or bun) is detected from package.json and the lockfile
+- without args the dev script is run, falling back to start, a script can be given by name
+- an explicit command like "yarn dev" or "node server.js" is run as it is, unless a script has its name
+- paths like ./bin/server are always run as they are
 
 		`,
 		Run: func(cmd *cobra.Command, args []string) {
@@ -32,33 +41,63 @@ var (
 				logger.Error("could not determine working directory", zap.Error(errWd))
 				return
 			}
-			npmCommand := "yarn"
-			if len(args) > 0 {
-				npmCommand = args[0]
+			npmCommand, npmArgs, errResolve := clientnpm.ResolveCommand(wd, args)
+			if errResolve != nil {
+				logger.Error("could not resolve what to run", zap.String("error", errResolve.Error()))
+				return
+			}
+			logger.Info("running", zap.String("command", npmCommand), zap.Strings("args", npmArgs))
+			debugPort := flagDebugServerPort
+			if flagDebugJetBrains {
+				if debugPort == 0 {
+					freePort, errFreePort := clientexec.FreePort()
+					if errFreePort != nil {
+						logger.Error("could not find a free debug port", zap.Error(errFreePort))
+						return
+					}
+					debugPort = freePort
+				}
+				if errJetBrains := clientnpm.JetBrainsDebug(logger.Sugar(), wd, filepath.Base(wd), debugPort); errJetBrains != nil {
+					logger.Error("could not write jetbrains run configuration", zap.Error(errJetBrains))
+					return
+				}
 			}
-			npmArgs := []string{}
-			if len(args) > 1 {
-				npmArgs = args[1:]
+			supervisorConfig, errSupervisorConfig := supervisorConfigFromFlags()
+			if errSupervisorConfig != nil {
+				logger.Error("invalid restart flags", zap.Error(errSupervisorConfig))
+				return
 			}
-			errRun := clientnpm.Run(
+			errRun := clientnpm.RunWithOptions(
 				cmd.Context(),
 				logger.Sugar(),
 				flagReverseProxyURL,
-				flagPort, flagDebugServerPort, flagStartVSCode,
-				flagConfigPath, wd, npmCommand, npmArgs...,
+				flagPort, debugPort, flagStartVSCode,
+				flagConfigPath, wd, npmCommand, npmArgs,
+				clientexec.WithReadyTimeout(flagReadyTimeout),
+				clientexec.WithHealthPath(flagHealthPath),
+				clientexec.WithSupervisor(supervisorConfig),
+				clientexec.WithGracePeriod(flagGracePeriod),
+				clientexec.WithPublicURL(flagPublicURL),
+				clientexec.WithCACertFile(flagCACert),
 			)
 			if errRun != nil {
 				logger.Error("run failed", zap.String("error", errRun.Error()))
 			}
 			logger.Info("shutting down")
+			exitWithCommandCode(errRun)
 		},
 	}
 )
 
 func init() {
+	addSupervisorFlags(clientNPMCmd)
+	addEnvFlags(clientNPMCmd)
 	clientNPMCmd.Flags().StringVar(&flagReverseProxyURL, "reverse-proxy-url", flagReverseProxyURL, "reverse proxy url")
 	clientNPMCmd.Flags().StringVar(&flagConfigPath, "config", flagConfigPath, "path to webgrapple.yaml")
 	clientNPMCmd.Flags().IntVar(&flagDebugServerPort, "debug-port", flagDebugServerPort, "start debug session on the given port NODE_DEBUG_PORT will be set")
-	clientNPMCmd.Flags().BoolVar(&flagStartVSCode, "debug-vscode", flagStartVSCode, "start a debug session in vscode, if no debug-port is defined it will be automatically assigned in NODE_DEBUG_PORT")
+	clientNPMCmd.Flags().BoolVar(&flagStartVSCode, "debug-vscode", flagStartVSCode, "add an attach configuration to launch.json or the .code-workspace and start a debug session in vscode, if no debug-port is defined it will be automatically assigned in NODE_DEBUG_PORT")
+	clientNPMCmd.Flags().BoolVar(&flagDebugJetBrains, "debug-jetbrains", flagDebugJetBrains, "write an attach run configuration to .idea/runConfigurations for WebStorm and IntelliJ, if no debug-port is defined it will be automatically assigned in NODE_DEBUG_PORT")
+	clientNPMCmd.Flags().DurationVar(&flagReadyTimeout, "ready-timeout", flagReadyTimeout, "how long to wait for the server to listen, services are registered with the proxy once it does")
+	clientNPMCmd.Flags().StringVar(&flagHealthPath, "health-path", flagHealthPath, "http path to check, if a service is ready, for services without healthPath, by default a tcp connect is enough")
 	clientNPMCmd.Flags().IntVar(&flagPort, "port", flagPort, "which port to use, if 0 client-npm will look for a free port and set env PORT")
 }
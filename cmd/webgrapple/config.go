@@ -0,0 +1,44 @@
+package webgrapple
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/foomo/webgrapple/pkg/clientconfig"
+	"github.com/spf13/cobra"
+)
+
+var (
+	configCmd = &cobra.Command{
+		Use:   "config",
+		Short: "webgrapple.yaml schema and validation",
+	}
+	configSchemaCmd = &cobra.Command{
+		Use:   "schema",
+		Short: "print the JSON Schema of webgrapple.yaml for editor autocompletion",
+		Run: func(cmd *cobra.Command, args []string) {
+			_, _ = os.Stdout.Write(clientconfig.Schema)
+		},
+	}
+	configCheckCmd = &cobra.Command{
+		Use:   "check [webgrapple.yaml]",
+		Short: "validate a webgrapple.yaml, problems are reported with file:line:column",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			file := "webgrapple.yaml"
+			if len(args) > 0 {
+				file = args[0]
+			}
+			config, errRead := clientconfig.ReadConfig(file)
+			if errRead != nil {
+				fmt.Fprintln(os.Stderr, errRead)
+				os.Exit(1)
+			}
+			fmt.Printf("%s: %d services\n", file, len(config))
+		},
+	}
+)
+
+func init() {
+	configCmd.AddCommand(configSchemaCmd, configCheckCmd)
+}
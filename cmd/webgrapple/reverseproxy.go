@@ -1,6 +1,13 @@
 package webgrapple
 
 import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/foomo/webgrapple/pkg/certs"
+	"github.com/foomo/webgrapple/pkg/har"
+	"github.com/foomo/webgrapple/pkg/responsecache"
 	"github.com/foomo/webgrapple/pkg/server"
 	"github.com/foomo/webgrapple/pkg/utils"
 	"github.com/spf13/cobra"
@@ -17,6 +24,48 @@ var (
 	flagCert           = ""
 	flagKey            = ""
 	flagServiceAddress = DefaultServiceAddress
+	flagBackendProxy   = ""
+	flagCADir          = ""
+	flagCertDir        = ""
+	flagCACert         = ""
+	flagCAKey          = ""
+	flagSNIAllow       = []string{}
+
+	flagCertKeyType            = ""
+	flagCertValidity           = time.Duration(0)
+	flagCertCommonName         = ""
+	flagCertOrganization       = []string{}
+	flagCertOrganizationalUnit = []string{}
+	flagCertCountry            = []string{}
+	flagCertLocality           = []string{}
+	flagCertSANs               = []string{}
+	flagCertExtKeyUsages       = []string{}
+
+	flagACME            = false
+	flagACMEDirectory   = ""
+	flagACMEEmail       = ""
+	flagACMECacheDir    = ""
+	flagACMEDirectoryCA = ""
+	flagACMERenewBefore = time.Duration(0)
+
+	flagBackendBasicAuthUser     = ""
+	flagBackendBasicAuthPassword = ""
+	flagBackendHeaders           = []string{}
+	flagBackendOAuth2TokenURL    = ""
+	flagBackendOAuth2ClientID    = ""
+	flagBackendOAuth2Secret      = ""
+	flagBackendOAuth2Scopes      = []string{}
+
+	flagHARDir           = "."
+	flagHARCapture       = false
+	flagHARMaxBodySize   = har.DefaultMaxBodySize
+	flagHARRedactHeaders = har.DefaultRedactHeaders
+
+	flagCache           = false
+	flagOffline         = false
+	flagCacheDir        = responsecache.DefaultDir()
+	flagCacheKeyHeaders = responsecache.DefaultKeyHeaders
+	flagCachePrivate    = false
 
 	serverCmd = &cobra.Command{
 		Use:   "reverse-proxy",
@@ -28,6 +77,45 @@ var (
 			if MiddlewareFactory == nil {
 				logger.Fatal("middleware factory MUST be set")
 			}
+			leafConfig, errLeafConfig := leafConfigFromFlags()
+			if errLeafConfig != nil {
+				logger.Fatal("invalid certificate parameters", zap.Error(errLeafConfig))
+			}
+			backendAuth, errBackendAuth := backendAuthFromFlags()
+			if errBackendAuth != nil {
+				logger.Fatal("invalid backend auth", zap.Error(errBackendAuth))
+			}
+			opts := []server.Option{
+				server.WithCADir(flagCADir),
+				server.WithCertDir(flagCertDir),
+				server.WithCA(flagCACert, flagCAKey),
+				server.WithSNIAllow(flagSNIAllow),
+				server.WithLeafConfig(leafConfig),
+				server.WithBackendProxy(flagBackendProxy),
+				server.WithBackendAuth(backendAuth),
+				server.WithHAR(har.Config{
+					Dir:           flagHARDir,
+					MaxBodySize:   flagHARMaxBodySize,
+					RedactHeaders: flagHARRedactHeaders,
+				}, flagHARCapture),
+			}
+			if flagACME || flagACMEDirectory != "" {
+				opts = append(opts, server.WithACME(server.ACMEConfig{
+					DirectoryURL:    flagACMEDirectory,
+					Email:           flagACMEEmail,
+					CacheDir:        flagACMECacheDir,
+					DirectoryCAFile: flagACMEDirectoryCA,
+					RenewBefore:     flagACMERenewBefore,
+				}))
+			}
+			if flagCache || flagOffline {
+				opts = append(opts, server.WithResponseCache(responsecache.Config{
+					Dir:        flagCacheDir,
+					KeyHeaders: flagCacheKeyHeaders,
+					Offline:    flagOffline,
+					Private:    flagCachePrivate,
+				}))
+			}
 			errRun := server.Run(
 				cmd.Context(),
 				logger.Sugar(),
@@ -37,6 +125,7 @@ var (
 				flagCert,
 				flagKey,
 				MiddlewareFactory,
+				opts...,
 			)
 			if errRun != nil {
 				logger.Error("could not run server", zap.Error(errRun))
@@ -45,10 +134,98 @@ var (
 	}
 )
 
+func leafConfigFromFlags() (certs.LeafConfig, error) {
+	config := certs.LeafConfig{
+		Validity:           flagCertValidity,
+		CommonName:         flagCertCommonName,
+		Organization:       flagCertOrganization,
+		OrganizationalUnit: flagCertOrganizationalUnit,
+		Country:            flagCertCountry,
+		Locality:           flagCertLocality,
+		ExtraSANs:          flagCertSANs,
+	}
+	if flagCertKeyType != "" {
+		keyType, errKeyType := certs.ParseKeyType(flagCertKeyType)
+		if errKeyType != nil {
+			return config, errKeyType
+		}
+		config.KeyType = keyType
+	}
+	for _, name := range flagCertExtKeyUsages {
+		usage, errUsage := certs.ParseExtKeyUsage(name)
+		if errUsage != nil {
+			return config, errUsage
+		}
+		config.ExtKeyUsage = append(config.ExtKeyUsage, usage)
+	}
+	return config, nil
+}
+
+func backendAuthFromFlags() (server.BackendAuth, error) {
+	auth := server.BackendAuth{
+		BasicUser:     flagBackendBasicAuthUser,
+		BasicPassword: flagBackendBasicAuthPassword,
+		Headers:       map[string]string{},
+	}
+	for _, header := range flagBackendHeaders {
+		name, value, ok := strings.Cut(header, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return auth, errors.New("backend headers have to be given as Name=value, got " + header)
+		}
+		auth.Headers[strings.TrimSpace(name)] = value
+	}
+	if flagBackendOAuth2TokenURL != "" {
+		auth.OAuth2 = &server.OAuth2ClientCredentials{
+			TokenURL:     flagBackendOAuth2TokenURL,
+			ClientID:     flagBackendOAuth2ClientID,
+			ClientSecret: flagBackendOAuth2Secret,
+			Scopes:       flagBackendOAuth2Scopes,
+		}
+	}
+	return auth, nil
+}
+
 func init() {
 	serverCmd.Flags().StringArrayVarP(&flagAddresses, "addresses", "a", flagAddresses, "what adresses to listen to / self sign a cert for")
 	serverCmd.Flags().StringVar(&flagCert, "cert", flagCert, "cert file relative path")
 	serverCmd.Flags().StringVar(&flagKey, "key", flagKey, "key file relative path")
+	serverCmd.Flags().StringVar(&flagCertDir, "cert-dir", flagCertDir, "private directory for generated certificates and keys, defaults to $XDG_STATE_HOME/webgrapple/certs")
+	serverCmd.Flags().StringVar(&flagCADir, "ca-dir", flagCADir, "directory of the local CA, that signs certificates, defaults to webgrapple/ca in the user config dir")
+	serverCmd.Flags().StringVar(&flagCACert, "ca-cert", flagCACert, "sign certificates with this CA cert instead of the local CA, CAROOT of mkcert is used if set")
+	serverCmd.Flags().StringVar(&flagCAKey, "ca-key", flagCAKey, "key of the CA given with --ca-cert")
+	serverCmd.Flags().StringSliceVar(&flagSNIAllow, "sni-allow", flagSNIAllow, "issue certificates on demand for sni host names matching these patterns, e.g. *.test")
+	serverCmd.Flags().BoolVar(&flagACME, "acme", flagACME, "get certificates from an ACME server instead of the local CA, challenges are answered on the proxies own listeners")
+	serverCmd.Flags().StringVar(&flagACMEDirectory, "acme-directory", flagACMEDirectory, "ACME directory url, e.g. of a step-ca, implies --acme, defaults to Let's Encrypt")
+	serverCmd.Flags().StringVar(&flagACMEEmail, "acme-email", flagACMEEmail, "contact email for the ACME account")
+	serverCmd.Flags().StringVar(&flagACMECacheDir, "acme-cache-dir", flagACMECacheDir, "where ACME account keys and certificates are cached, defaults to $XDG_STATE_HOME/webgrapple/acme")
+	serverCmd.Flags().StringVar(&flagACMEDirectoryCA, "acme-directory-ca", flagACMEDirectoryCA, "PEM file with a root CA to trust, when talking to the ACME directory")
+	serverCmd.Flags().DurationVar(&flagACMERenewBefore, "acme-renew-before", flagACMERenewBefore, "renew ACME certificates this long before they expire, defaults to 30 days")
+	serverCmd.Flags().StringVar(&flagCertKeyType, "cert-key-type", flagCertKeyType, "key type of issued certificates: rsa2048, rsa4096, ecdsa-p256, ecdsa-p384 or ed25519, defaults to ecdsa-p256")
+	serverCmd.Flags().DurationVar(&flagCertValidity, "cert-validity", flagCertValidity, "validity of issued certificates, defaults to "+certs.LeafValidity.String())
+	serverCmd.Flags().StringVar(&flagCertCommonName, "cert-common-name", flagCertCommonName, "subject common name of issued certificates, defaults to the first host")
+	serverCmd.Flags().StringSliceVar(&flagCertOrganization, "cert-organization", flagCertOrganization, "subject organization of issued certificates")
+	serverCmd.Flags().StringSliceVar(&flagCertOrganizationalUnit, "cert-organizational-unit", flagCertOrganizationalUnit, "subject organizational unit of issued certificates")
+	serverCmd.Flags().StringSliceVar(&flagCertCountry, "cert-country", flagCertCountry, "subject country of issued certificates")
+	serverCmd.Flags().StringSliceVar(&flagCertLocality, "cert-locality", flagCertLocality, "subject locality of issued certificates")
+	serverCmd.Flags().StringSliceVar(&flagCertSANs, "cert-san", flagCertSANs, "extra host names and ip addresses to add to issued certificates")
+	serverCmd.Flags().StringSliceVar(&flagCertExtKeyUsages, "cert-ext-key-usage", flagCertExtKeyUsages, "extended key usages of issued certificates: server-auth, client-auth, defaults to server-auth")
 	serverCmd.Flags().StringVar(&flagBackendURL, "backend", flagBackendURL, "backend url")
 	serverCmd.Flags().StringVar(&flagServiceAddress, "service-addr", flagServiceAddress, "service address url")
+	serverCmd.Flags().StringVar(&flagBackendProxy, "backend-proxy", flagBackendProxy, "upstream proxy url for backend traffic (http, https, socks5), defaults to HTTP_PROXY / HTTPS_PROXY / NO_PROXY from env")
+	serverCmd.Flags().StringVar(&flagBackendBasicAuthUser, "backend-basic-auth-user", flagBackendBasicAuthUser, "basic auth user for requests to the backend")
+	serverCmd.Flags().StringVar(&flagBackendBasicAuthPassword, "backend-basic-auth-password", flagBackendBasicAuthPassword, "basic auth password for the backend as env:NAME or file:PATH")
+	serverCmd.Flags().StringArrayVar(&flagBackendHeaders, "backend-header", flagBackendHeaders, "static header for requests to the backend as Name=value, value may be env:NAME or file:PATH")
+	serverCmd.Flags().StringVar(&flagBackendOAuth2TokenURL, "backend-oauth2-token-url", flagBackendOAuth2TokenURL, "oauth2 token url to fetch client credentials tokens for the backend from")
+	serverCmd.Flags().StringVar(&flagBackendOAuth2ClientID, "backend-oauth2-client-id", flagBackendOAuth2ClientID, "oauth2 client id for the backend")
+	serverCmd.Flags().StringVar(&flagBackendOAuth2Secret, "backend-oauth2-client-secret", flagBackendOAuth2Secret, "oauth2 client secret for the backend as env:NAME or file:PATH")
+	serverCmd.Flags().StringVar(&flagHARDir, "har-dir", flagHARDir, "directory to write HAR captures to")
+	serverCmd.Flags().BoolVar(&flagHARCapture, "har-capture", flagHARCapture, "start capturing traffic into a HAR file right away, otherwise use webgrapple capture start")
+	serverCmd.Flags().Int64Var(&flagHARMaxBodySize, "har-max-body-size", flagHARMaxBodySize, "truncate captured bodies to this many bytes, -1 to not capture bodies")
+	serverCmd.Flags().StringSliceVar(&flagHARRedactHeaders, "har-redact-header", flagHARRedactHeaders, "headers, whose values will be redacted in HAR captures")
+	serverCmd.Flags().StringSliceVar(&flagBackendOAuth2Scopes, "backend-oauth2-scope", flagBackendOAuth2Scopes, "oauth2 scopes to request for the backend")
+	serverCmd.Flags().BoolVar(&flagCache, "cache", flagCache, "record cacheable backend responses to the cache dir")
+	serverCmd.Flags().BoolVar(&flagOffline, "offline", flagOffline, "do not talk to the backend, replay responses recorded with --cache instead")
+	serverCmd.Flags().StringVar(&flagCacheDir, "cache-dir", flagCacheDir, "directory for recorded backend responses")
+	serverCmd.Flags().StringSliceVar(&flagCacheKeyHeaders, "cache-key-header", flagCacheKeyHeaders, "request headers, that identify a recorded response together with method and url")
+	serverCmd.Flags().BoolVar(&flagCachePrivate, "cache-private", flagCachePrivate, "also record responses, that are private or set cookies")
 }
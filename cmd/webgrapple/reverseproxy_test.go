@@ -0,0 +1,37 @@
+package webgrapple
+
+import (
+	"crypto/x509"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/foomo/webgrapple/pkg/certs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeafConfigFromFlagsKeepsExplicitCerts(t *testing.T) {
+	leafConfig, errLeafConfig := leafConfigFromFlags()
+	require.NoError(t, errLeafConfig)
+	assert.Zero(t, leafConfig.Validity)
+	assert.Empty(t, leafConfig.ExtKeyUsage)
+
+	// a long lived cert brought by the user, signed by another CA
+	dir := t.TempDir()
+	ca, _, errCA := certs.LoadOrCreateCA(filepath.Join(dir, "ca"))
+	require.NoError(t, errCA)
+	certPEM, keyPEM, errIssue := ca.Issue([]string{"localhost"}, certs.LeafConfig{Validity: 800 * 24 * time.Hour})
+	require.NoError(t, errIssue)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, certs.WriteCertAndKey(certFile, keyFile, certPEM, keyPEM))
+	require.NoError(t, certs.CheckLeaf(certFile, keyFile, []string{"localhost"}, leafConfig, time.Now()))
+
+	// certificates issued with the unset config still get the defaults
+	issuedPEM, _, errIssueDefault := ca.Issue([]string{"localhost"}, leafConfig)
+	require.NoError(t, errIssueDefault)
+	issued, errParse := certs.ParseCertificate(issuedPEM)
+	require.NoError(t, errParse)
+	assert.Equal(t, certs.LeafValidity, issued.NotAfter.Sub(issued.NotBefore))
+	assert.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, issued.ExtKeyUsage)
+}
@@ -0,0 +1,36 @@
+package webgrapple
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/foomo/webgrapple/pkg/server"
+	"github.com/foomo/webgrapple/pkg/utils"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var servicesCmd = &cobra.Command{
+	Use:   "services",
+	Short: "print the services of a running reverse proxy as json, including debugger attach urls",
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := utils.GetLogger()
+		client := server.NewServiceGoTSRPCClient(flagReverseProxyURL, server.DefaultEndPoint)
+		services, errServices, errClient := client.Services(cmd.Context())
+		if errClient != nil {
+			logger.Fatal("could not reach reverse proxy", zap.Error(errClient))
+		}
+		if errServices != nil {
+			logger.Fatal("could not list services", zap.Error(errServices))
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if errEncode := encoder.Encode(services); errEncode != nil {
+			logger.Fatal("could not write services", zap.Error(errEncode))
+		}
+	},
+}
+
+func init() {
+	servicesCmd.Flags().StringVar(&flagReverseProxyURL, "reverse-proxy-url", flagReverseProxyURL, "reverse proxy url")
+}
@@ -16,4 +16,9 @@ var (
 func init() {
 	Command.AddCommand(serverCmd)
 	Command.AddCommand(clientNPMCmd)
+	Command.AddCommand(clientExecCmd)
+	Command.AddCommand(captureCmd)
+	Command.AddCommand(servicesCmd)
+	Command.AddCommand(configCmd)
+	Command.AddCommand(certCmd)
 }
@@ -0,0 +1,224 @@
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// CACertFileName name of the root certificate file in a CA dir
+	CACertFileName = "rootCA.pem"
+	// CAKeyFileName name of the root key file in a CA dir
+	CAKeyFileName = "rootCA-key.pem"
+
+	caValidity = 10 * 365 * 24 * time.Hour
+)
+
+// CA a certificate authority, that signs leaf certificates
+type CA struct {
+	Cert     *x509.Certificate
+	Key      crypto.Signer
+	CertFile string
+	KeyFile  string
+}
+
+// DefaultCADir where the local webgrapple CA lives in the users config dir
+func DefaultCADir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("could not determine user config dir: %w", err)
+	}
+	return filepath.Join(configDir, "webgrapple", "ca"), nil
+}
+
+// ResolveCADir where to find the CA: CAROOT, if it contains an mkcert CA, otherwise caDir or the
+// default CA dir, if caDir is empty
+func ResolveCADir(caDir string) (dir string, fromCAROOT bool, err error) {
+	if caRoot := os.Getenv("CAROOT"); caRoot != "" {
+		complete := true
+		for _, file := range []string{CACertFileName, CAKeyFileName} {
+			info, errStat := os.Stat(filepath.Join(caRoot, file))
+			switch {
+			case errors.Is(errStat, os.ErrNotExist):
+				complete = false
+			case errStat != nil:
+				return "", false, errStat
+			case !info.Mode().IsRegular():
+				return "", false, fmt.Errorf("%q is not a file", filepath.Join(caRoot, file))
+			}
+		}
+		if complete {
+			return caRoot, true, nil
+		}
+	}
+	if caDir != "" {
+		return caDir, false, nil
+	}
+	caDir, err = DefaultCADir()
+	return caDir, false, err
+}
+
+// ResolveCAFiles the CA files certificates are signed with: caCertFile and caKeyFile, if given, the mkcert CA in
+// CAROOT, if there is one, otherwise the local CA in caDir or the default CA dir, which may not exist yet
+func ResolveCAFiles(caDir, caCertFile, caKeyFile string) (certFile, keyFile string, local bool, err error) {
+	if caCertFile != "" || caKeyFile != "" {
+		if caCertFile == "" || caKeyFile == "" {
+			return "", "", false, errors.New("a CA needs both a cert and a key")
+		}
+		return caCertFile, caKeyFile, false, nil
+	}
+	dir, fromCAROOT, errCADir := ResolveCADir(caDir)
+	if errCADir != nil {
+		return "", "", false, errCADir
+	}
+	return filepath.Join(dir, CACertFileName), filepath.Join(dir, CAKeyFileName), !fromCAROOT, nil
+}
+
+// LoadOrCreateCA load the CA from dir, or create a new one, if there is none yet
+func LoadOrCreateCA(dir string) (ca *CA, created bool, err error) {
+	certFile := filepath.Join(dir, CACertFileName)
+	keyFile := filepath.Join(dir, CAKeyFileName)
+	_, errStatCert := os.Stat(certFile)
+	_, errStatKey := os.Stat(keyFile)
+	switch {
+	case errStatCert == nil && errStatKey == nil:
+		if errPrivate := CheckPrivateFile(keyFile); errPrivate != nil {
+			return nil, false, fmt.Errorf("refusing to use CA key: %w", errPrivate)
+		}
+		ca, err = LoadCA(certFile, keyFile)
+		return ca, false, err
+	case errors.Is(errStatCert, os.ErrNotExist) && errors.Is(errStatKey, os.ErrNotExist):
+		ca, err = createCA(dir, certFile, keyFile)
+		return ca, err == nil, err
+	case errStatCert != nil && !errors.Is(errStatCert, os.ErrNotExist):
+		return nil, false, errStatCert
+	case errStatKey != nil && !errors.Is(errStatKey, os.ErrNotExist):
+		return nil, false, errStatKey
+	default:
+		return nil, false, fmt.Errorf("incomplete CA in %q, either the cert or the key is missing", dir)
+	}
+}
+
+// LoadCA load a CA cert and key from PEM files
+func LoadCA(certFile, keyFile string) (*CA, error) {
+	cert, errCert := ReadCertificate(certFile)
+	if errCert != nil {
+		return nil, errCert
+	}
+	if !cert.IsCA {
+		return nil, fmt.Errorf("%q is not a CA certificate", certFile)
+	}
+	key, errKey := ReadPrivateKey(keyFile)
+	if errKey != nil {
+		return nil, errKey
+	}
+	if !PublicKeysEqual(cert.PublicKey, key.Public()) {
+		return nil, fmt.Errorf("CA key %q does not match the certificate %q", keyFile, certFile)
+	}
+	return &CA{
+		Cert:     cert,
+		Key:      key,
+		CertFile: certFile,
+		KeyFile:  keyFile,
+	}, nil
+}
+
+func userAndHost() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		name += "@" + host
+	}
+	return name
+}
+
+func createCA(dir, certFile, keyFile string) (*CA, error) {
+	if err := EnsurePrivateDir(dir); err != nil {
+		return nil, fmt.Errorf("could not create CA dir: %w", err)
+	}
+	key, errKey := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if errKey != nil {
+		return nil, fmt.Errorf("failed to generate CA key: %w", errKey)
+	}
+	serialNumber, errSerial := newSerialNumber()
+	if errSerial != nil {
+		return nil, errSerial
+	}
+	owner := userAndHost()
+	notBefore := time.Now().Add(-time.Hour)
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			Organization:       []string{"webgrapple local CA"},
+			OrganizationalUnit: []string{owner},
+			CommonName:         "webgrapple " + owner,
+		},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	derBytes, errCreate := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if errCreate != nil {
+		return nil, fmt.Errorf("failed to create CA certificate: %w", errCreate)
+	}
+	cert, errParse := x509.ParseCertificate(derBytes)
+	if errParse != nil {
+		return nil, errParse
+	}
+	keyPEM, errKeyPEM := encodePrivateKey(key)
+	if errKeyPEM != nil {
+		return nil, errKeyPEM
+	}
+	if err := WriteCertAndKey(certFile, keyFile, encodeCertificate(derBytes), keyPEM); err != nil {
+		return nil, err
+	}
+	return &CA{
+		Cert:     cert,
+		Key:      key,
+		CertFile: certFile,
+		KeyFile:  keyFile,
+	}, nil
+}
+
+// Signed tells, if cert was issued by the CA
+func (ca *CA) Signed(cert *x509.Certificate) bool {
+	return cert.CheckSignatureFrom(ca.Cert) == nil
+}
+
+func newSerialNumber() (*big.Int, error) {
+	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
+	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	return serialNumber, nil
+}
+
+func encodeCertificate(derBytes []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
+}
+
+func encodePrivateKey(key crypto.Signer) ([]byte, error) {
+	privBytes, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal private key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privBytes}), nil
+}
@@ -0,0 +1,168 @@
+package certs
+
+import (
+	"crypto/x509"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCAIssue(t *testing.T) {
+	dir := t.TempDir()
+	ca, created, errCreate := LoadOrCreateCA(dir)
+	require.NoError(t, errCreate)
+	assert.True(t, created)
+
+	loadedCA, created, errLoad := LoadOrCreateCA(dir)
+	require.NoError(t, errLoad)
+	assert.False(t, created)
+	assert.True(t, loadedCA.Cert.Equal(ca.Cert))
+
+	certPEM, _, errIssue := loadedCA.Issue([]string{"webgrapple.test", "127.0.0.1"}, LeafConfig{})
+	require.NoError(t, errIssue)
+	leaf, errParse := ParseCertificate(certPEM)
+	require.NoError(t, errParse)
+	assert.True(t, ca.Signed(leaf))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+	for _, name := range []string{"webgrapple.test", "127.0.0.1"} {
+		_, errVerify := leaf.Verify(x509.VerifyOptions{DNSName: name, Roots: roots})
+		require.NoError(t, errVerify, name)
+	}
+}
+
+func TestCheckLeaf(t *testing.T) {
+	dir := t.TempDir()
+	ca, _, errCreate := LoadOrCreateCA(dir)
+	require.NoError(t, errCreate)
+	certPEM, keyPEM, errIssue := ca.Issue([]string{"webgrapple.test"}, LeafConfig{})
+	require.NoError(t, errIssue)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, WriteCertAndKey(certFile, keyFile, certPEM, keyPEM))
+
+	require.NoError(t, CheckLeaf(certFile, keyFile, []string{"webgrapple.test"}, LeafConfig{}, time.Now()))
+	require.Error(t, CheckLeaf(certFile, keyFile, []string{"other.test"}, LeafConfig{}, time.Now()))
+	require.Error(t, CheckLeaf(certFile, keyFile, nil, LeafConfig{KeyType: KeyTypeRSA2048}, time.Now()))
+	require.Error(t, CheckLeaf(certFile, keyFile, nil, LeafConfig{}, time.Now().Add(LeafValidity*3/4)))
+	require.Error(t, CheckLeaf(certFile, keyFile, nil, LeafConfig{}, time.Now().Add(LeafValidity)))
+
+	_, otherKeyPEM, errIssueOther := ca.Issue([]string{"webgrapple.test"}, LeafConfig{})
+	require.NoError(t, errIssueOther)
+	require.NoError(t, WriteCertAndKey(certFile, keyFile, certPEM, otherKeyPEM))
+	require.Error(t, CheckLeaf(certFile, keyFile, nil, LeafConfig{}, time.Now()))
+}
+
+func TestCheckLeafConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca, _, errCreate := LoadOrCreateCA(dir)
+	require.NoError(t, errCreate)
+	issued := LeafConfig{
+		KeyType:            KeyTypeEd25519,
+		Validity:           10 * 24 * time.Hour,
+		CommonName:         "shop",
+		Organization:       []string{"acme"},
+		OrganizationalUnit: []string{"web"},
+		Country:            []string{"DE"},
+		Locality:           []string{"Munich"},
+		ExtraSANs:          []string{"extra.test"},
+		ExtKeyUsage:        []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	certPEM, keyPEM, errIssue := ca.Issue([]string{"webgrapple.test"}, issued)
+	require.NoError(t, errIssue)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, WriteCertAndKey(certFile, keyFile, certPEM, keyPEM))
+
+	for _, test := range []struct {
+		name    string
+		change  func(c *LeafConfig)
+		wantErr string
+	}{
+		{name: "same", change: func(c *LeafConfig) {}},
+		{name: "nothing configured", change: func(c *LeafConfig) { *c = LeafConfig{} }},
+		{name: "key type", change: func(c *LeafConfig) { c.KeyType = KeyTypeECDSAP256 }, wantErr: "cert key is Ed25519"},
+		{name: "validity", change: func(c *LeafConfig) { c.Validity = 20 * 24 * time.Hour }, wantErr: "cert is valid for 240h"},
+		{name: "common name", change: func(c *LeafConfig) { c.CommonName = "other" }, wantErr: "common name"},
+		{name: "organization", change: func(c *LeafConfig) { c.Organization = []string{"other"} }, wantErr: "organization"},
+		{name: "organizational unit", change: func(c *LeafConfig) { c.OrganizationalUnit = []string{"web", "api"} }, wantErr: "organizational unit"},
+		{name: "country", change: func(c *LeafConfig) { c.Country = []string{"FR"} }, wantErr: "country"},
+		{name: "locality", change: func(c *LeafConfig) { c.Locality = []string{"Paris"} }, wantErr: "locality"},
+		{name: "extra sans", change: func(c *LeafConfig) { c.ExtraSANs = []string{"other.test"} }, wantErr: `does not cover "other.test"`},
+		{name: "ext key usage", change: func(c *LeafConfig) { c.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth} }, wantErr: "extended key usage"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			config := issued
+			test.change(&config)
+			errCheck := CheckLeaf(certFile, keyFile, []string{"webgrapple.test"}, config, time.Now())
+			if test.wantErr == "" {
+				require.NoError(t, errCheck)
+				return
+			}
+			require.Error(t, errCheck)
+			assert.Contains(t, errCheck.Error(), test.wantErr)
+		})
+	}
+}
+
+func TestResolveCADir(t *testing.T) {
+	configHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+	t.Setenv("HOME", t.TempDir())
+	caRoot := t.TempDir()
+	t.Setenv("CAROOT", caRoot)
+
+	// an empty CAROOT is ignored
+	dir, fromCAROOT, errResolve := ResolveCADir("")
+	require.NoError(t, errResolve)
+	assert.False(t, fromCAROOT)
+	defaultDir, errDefault := DefaultCADir()
+	require.NoError(t, errDefault)
+	assert.Equal(t, defaultDir, dir)
+
+	dir, _, errResolve = ResolveCADir("/explicit")
+	require.NoError(t, errResolve)
+	assert.Equal(t, "/explicit", dir)
+
+	_, _, errCreate := LoadOrCreateCA(caRoot)
+	require.NoError(t, errCreate)
+	for _, caDir := range []string{"", "/explicit"} {
+		dir, fromCAROOT, errResolve = ResolveCADir(caDir)
+		require.NoError(t, errResolve)
+		assert.True(t, fromCAROOT)
+		assert.Equal(t, caRoot, dir)
+	}
+}
+
+func TestResolveCAFiles(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	caRoot := t.TempDir()
+	t.Setenv("CAROOT", caRoot)
+
+	certFile, keyFile, local, errResolve := ResolveCAFiles("/local", "", "")
+	require.NoError(t, errResolve)
+	assert.True(t, local)
+	assert.Equal(t, filepath.Join("/local", CACertFileName), certFile)
+	assert.Equal(t, filepath.Join("/local", CAKeyFileName), keyFile)
+
+	_, _, errCreate := LoadOrCreateCA(caRoot)
+	require.NoError(t, errCreate)
+	certFile, keyFile, local, errResolve = ResolveCAFiles("/local", "", "")
+	require.NoError(t, errResolve)
+	assert.False(t, local)
+	assert.Equal(t, filepath.Join(caRoot, CACertFileName), certFile)
+	assert.Equal(t, filepath.Join(caRoot, CAKeyFileName), keyFile)
+
+	// explicit files win over CAROOT
+	certFile, keyFile, local, errResolve = ResolveCAFiles("/local", "/ca.pem", "/ca-key.pem")
+	require.NoError(t, errResolve)
+	assert.False(t, local)
+	assert.Equal(t, "/ca.pem", certFile)
+	assert.Equal(t, "/ca-key.pem", keyFile)
+
+	_, _, _, errResolve = ResolveCAFiles("", "/ca.pem", "")
+	assert.EqualError(t, errResolve, "a CA needs both a cert and a key")
+}
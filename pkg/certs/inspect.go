@@ -0,0 +1,135 @@
+package certs
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+var extKeyUsageNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:             "any",
+	x509.ExtKeyUsageServerAuth:      "server auth",
+	x509.ExtKeyUsageClientAuth:      "client auth",
+	x509.ExtKeyUsageCodeSigning:     "code signing",
+	x509.ExtKeyUsageEmailProtection: "email protection",
+	x509.ExtKeyUsageTimeStamping:    "time stamping",
+	x509.ExtKeyUsageOCSPSigning:     "ocsp signing",
+}
+
+var keyUsageNames = []struct {
+	usage x509.KeyUsage
+	name  string
+}{
+	{x509.KeyUsageDigitalSignature, "digital signature"},
+	{x509.KeyUsageContentCommitment, "content commitment"},
+	{x509.KeyUsageKeyEncipherment, "key encipherment"},
+	{x509.KeyUsageDataEncipherment, "data encipherment"},
+	{x509.KeyUsageKeyAgreement, "key agreement"},
+	{x509.KeyUsageCertSign, "cert sign"},
+	{x509.KeyUsageCRLSign, "crl sign"},
+}
+
+// ParseExtKeyUsage parse names like server-auth or client-auth
+func ParseExtKeyUsage(name string) (x509.ExtKeyUsage, error) {
+	for usage, usageName := range extKeyUsageNames {
+		if strings.ReplaceAll(usageName, " ", "-") == strings.ToLower(name) {
+			return usage, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown extended key usage %q", name)
+}
+
+// extKeyUsageList human readable names of extended key usages
+func extKeyUsageList(usages []x509.ExtKeyUsage) []string {
+	names := []string{}
+	for _, eku := range usages {
+		name, ok := extKeyUsageNames[eku]
+		if !ok {
+			name = fmt.Sprintf("unknown (%d)", eku)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// ReadCertificates read all certificates from a PEM file
+func ReadCertificates(file string) ([]*x509.Certificate, error) {
+	pemBytes, errRead := os.ReadFile(file)
+	if errRead != nil {
+		return nil, errRead
+	}
+	certificates := []*x509.Certificate{}
+	for {
+		var block *pem.Block
+		block, pemBytes = pem.Decode(pemBytes)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, errParse := x509.ParseCertificate(block.Bytes)
+		if errParse != nil {
+			return nil, errParse
+		}
+		certificates = append(certificates, cert)
+	}
+	if len(certificates) == 0 {
+		return nil, errors.New("no certificates found in " + file)
+	}
+	return certificates, nil
+}
+
+// Describe what a certificate covers in a human readable form
+func Describe(cert *x509.Certificate, now time.Time) string {
+	lines := []string{
+		"subject:      " + cert.Subject.String(),
+		"issuer:       " + cert.Issuer.String(),
+		"serial:       " + cert.SerialNumber.Text(16),
+		"key:          " + describeKey(cert.PublicKey),
+		fmt.Sprintf("ca:           %v", cert.IsCA),
+		"not before:   " + cert.NotBefore.Format(time.RFC3339),
+		"not after:    " + cert.NotAfter.Format(time.RFC3339),
+	}
+	switch {
+	case now.After(cert.NotAfter):
+		lines = append(lines, "status:       expired")
+	case now.Before(cert.NotBefore):
+		lines = append(lines, "status:       not yet valid")
+	case NeedsRenewal(cert, now):
+		lines = append(lines, fmt.Sprintf("status:       expires in %s, due for renewal", cert.NotAfter.Sub(now).Round(time.Minute)))
+	default:
+		lines = append(lines, fmt.Sprintf("status:       valid for %s", cert.NotAfter.Sub(now).Round(time.Minute)))
+	}
+	if len(cert.DNSNames) > 0 {
+		lines = append(lines, "dns names:    "+strings.Join(cert.DNSNames, ", "))
+	}
+	if len(cert.IPAddresses) > 0 {
+		ips := []string{}
+		for _, ip := range cert.IPAddresses {
+			ips = append(ips, ip.String())
+		}
+		lines = append(lines, "ip addresses: "+strings.Join(ips, ", "))
+	}
+	usages := []string{}
+	for _, ku := range keyUsageNames {
+		if cert.KeyUsage&ku.usage != 0 {
+			usages = append(usages, ku.name)
+		}
+	}
+	if len(usages) > 0 {
+		lines = append(lines, "key usage:    "+strings.Join(usages, ", "))
+	}
+	if extUsages := extKeyUsageList(cert.ExtKeyUsage); len(extUsages) > 0 {
+		lines = append(lines, "ext usage:    "+strings.Join(extUsages, ", "))
+	}
+	fingerprint := sha256.Sum256(cert.Raw)
+	lines = append(lines, "sha256:       "+strings.ToUpper(hex.EncodeToString(fingerprint[:])))
+	return strings.Join(lines, "\n")
+}
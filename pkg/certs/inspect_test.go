@@ -0,0 +1,116 @@
+package certs
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExtKeyUsage(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		want x509.ExtKeyUsage
+	}{
+		{name: "any", want: x509.ExtKeyUsageAny},
+		{name: "server-auth", want: x509.ExtKeyUsageServerAuth},
+		{name: "client-auth", want: x509.ExtKeyUsageClientAuth},
+		{name: "code-signing", want: x509.ExtKeyUsageCodeSigning},
+		{name: "email-protection", want: x509.ExtKeyUsageEmailProtection},
+		{name: "time-stamping", want: x509.ExtKeyUsageTimeStamping},
+		{name: "ocsp-signing", want: x509.ExtKeyUsageOCSPSigning},
+		{name: "Server-Auth", want: x509.ExtKeyUsageServerAuth},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			usage, errParse := ParseExtKeyUsage(test.name)
+			require.NoError(t, errParse)
+			assert.Equal(t, test.want, usage)
+		})
+	}
+	for _, name := range []string{"", "server auth", "serverAuth", "ipsec-user"} {
+		_, errParse := ParseExtKeyUsage(name)
+		assert.ErrorContains(t, errParse, "unknown extended key usage", name)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	dir := t.TempDir()
+	ca, _, errCreate := LoadOrCreateCA(dir)
+	require.NoError(t, errCreate)
+	for _, keyType := range KeyTypes {
+		t.Run(string(keyType), func(t *testing.T) {
+			certPEM, _, errIssue := ca.Issue([]string{"webgrapple.test", "127.0.0.1"}, LeafConfig{
+				KeyType:     keyType,
+				ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageIPSECUser},
+			})
+			require.NoError(t, errIssue)
+			cert, errParse := ParseCertificate(certPEM)
+			require.NoError(t, errParse)
+			description := Describe(cert, time.Now())
+			assert.Contains(t, description, "subject:      CN=webgrapple.test,O=webgrapple")
+			assert.Contains(t, description, "key:          "+describeKey(cert.PublicKey))
+			assert.Contains(t, description, "ca:           false")
+			assert.Contains(t, description, "status:       valid for ")
+			assert.Contains(t, description, "dns names:    webgrapple.test")
+			assert.Contains(t, description, "ip addresses: 127.0.0.1")
+			assert.Contains(t, description, "ext usage:    server auth, client auth, unknown (7)")
+			if strings.HasPrefix(string(keyType), "rsa") {
+				assert.Contains(t, description, "key usage:    digital signature, key encipherment")
+			} else {
+				assert.Contains(t, description, "key usage:    digital signature\n")
+			}
+		})
+	}
+
+	caDescription := Describe(ca.Cert, time.Now())
+	assert.Contains(t, caDescription, "ca:           true")
+	assert.Contains(t, caDescription, "key usage:    cert sign, crl sign")
+	assert.NotContains(t, caDescription, "ext usage")
+	for _, test := range []struct {
+		now    time.Time
+		status string
+	}{
+		{now: ca.Cert.NotBefore.Add(-time.Minute), status: "status:       not yet valid"},
+		{now: ca.Cert.NotAfter.Add(-24 * time.Hour), status: "status:       expires in 24h0m0s, due for renewal"},
+		{now: ca.Cert.NotAfter.Add(time.Minute), status: "status:       expired"},
+	} {
+		assert.Contains(t, Describe(ca.Cert, test.now), test.status)
+	}
+}
+
+func TestReadCertificates(t *testing.T) {
+	dir := t.TempDir()
+	ca, _, errCreate := LoadOrCreateCA(dir)
+	require.NoError(t, errCreate)
+	certPEM, keyPEM, errIssue := ca.Issue([]string{"webgrapple.test"}, LeafConfig{})
+	require.NoError(t, errIssue)
+	caPEM, errReadCA := os.ReadFile(ca.CertFile)
+	require.NoError(t, errReadCA)
+
+	chainFile := filepath.Join(dir, "chain.pem")
+	// keys in between are skipped
+	require.NoError(t, os.WriteFile(chainFile, append(append(append([]byte{}, certPEM...), keyPEM...), caPEM...), 0o600))
+	certificates, errRead := ReadCertificates(chainFile)
+	require.NoError(t, errRead)
+	require.Len(t, certificates, 2)
+	assert.Equal(t, "webgrapple.test", certificates[0].Subject.CommonName)
+	assert.True(t, certificates[1].Equal(ca.Cert))
+
+	keyFile := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(keyFile, keyPEM, 0o600))
+	_, errNoCerts := ReadCertificates(keyFile)
+	assert.ErrorContains(t, errNoCerts, "no certificates found")
+
+	brokenFile := filepath.Join(dir, "broken.pem")
+	require.NoError(t, os.WriteFile(brokenFile, []byte("-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----\n"), 0o600))
+	_, errBroken := ReadCertificates(brokenFile)
+	assert.Error(t, errBroken)
+
+	_, errMissing := ReadCertificates(filepath.Join(dir, "missing.pem"))
+	assert.ErrorIs(t, errMissing, os.ErrNotExist)
+}
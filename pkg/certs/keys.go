@@ -0,0 +1,105 @@
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"strings"
+)
+
+// KeyType of generated keys
+type KeyType string
+
+const (
+	KeyTypeRSA2048   KeyType = "rsa2048"
+	KeyTypeRSA4096   KeyType = "rsa4096"
+	KeyTypeECDSAP256 KeyType = "ecdsa-p256"
+	KeyTypeECDSAP384 KeyType = "ecdsa-p384"
+	KeyTypeEd25519   KeyType = "ed25519"
+)
+
+// DefaultKeyType used, when nothing else is configured
+const DefaultKeyType = KeyTypeECDSAP256
+
+// KeyTypes all supported key types
+var KeyTypes = []KeyType{
+	KeyTypeRSA2048,
+	KeyTypeRSA4096,
+	KeyTypeECDSAP256,
+	KeyTypeECDSAP384,
+	KeyTypeEd25519,
+}
+
+// ParseKeyType parse a key type name like rsa2048 or ecdsa-p256
+func ParseKeyType(name string) (KeyType, error) {
+	for _, keyType := range KeyTypes {
+		if strings.EqualFold(string(keyType), name) {
+			return keyType, nil
+		}
+	}
+	names := make([]string, 0, len(KeyTypes))
+	for _, keyType := range KeyTypes {
+		names = append(names, string(keyType))
+	}
+	return "", fmt.Errorf("unsupported key type %q, use one of %s", name, strings.Join(names, ", "))
+}
+
+// GenerateKey generate a private key of the given type
+func GenerateKey(keyType KeyType) (crypto.Signer, error) {
+	switch keyType {
+	case KeyTypeRSA2048:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case KeyTypeRSA4096:
+		return rsa.GenerateKey(rand.Reader, 4096)
+	case KeyTypeECDSAP256, "":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyTypeECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyTypeEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", keyType)
+	}
+}
+
+// KeyTypeOf tells the key type of a public key, empty if unknown
+func KeyTypeOf(pub crypto.PublicKey) KeyType {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		switch key.N.BitLen() {
+		case 2048:
+			return KeyTypeRSA2048
+		case 4096:
+			return KeyTypeRSA4096
+		}
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return KeyTypeECDSAP256
+		case elliptic.P384():
+			return KeyTypeECDSAP384
+		}
+	case ed25519.PublicKey:
+		return KeyTypeEd25519
+	}
+	return ""
+}
+
+// describeKey a human readable description of a public key
+func describeKey(pub crypto.PublicKey) string {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d bit", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA " + key.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return fmt.Sprintf("unknown %T", pub)
+	}
+}
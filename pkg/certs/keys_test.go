@@ -0,0 +1,60 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateKey(t *testing.T) {
+	for _, test := range []struct {
+		keyType KeyType
+		want    KeyType
+		desc    string
+	}{
+		{keyType: KeyTypeRSA2048, want: KeyTypeRSA2048, desc: "RSA 2048 bit"},
+		{keyType: KeyTypeRSA4096, want: KeyTypeRSA4096, desc: "RSA 4096 bit"},
+		{keyType: KeyTypeECDSAP256, want: KeyTypeECDSAP256, desc: "ECDSA P-256"},
+		{keyType: KeyTypeECDSAP384, want: KeyTypeECDSAP384, desc: "ECDSA P-384"},
+		{keyType: KeyTypeEd25519, want: KeyTypeEd25519, desc: "Ed25519"},
+		{keyType: "", want: DefaultKeyType, desc: "ECDSA P-256"},
+	} {
+		t.Run(string(test.keyType), func(t *testing.T) {
+			key, errKey := GenerateKey(test.keyType)
+			require.NoError(t, errKey)
+			assert.Equal(t, test.want, KeyTypeOf(key.Public()))
+			assert.Equal(t, test.desc, describeKey(key.Public()))
+		})
+	}
+	_, errUnsupported := GenerateKey("dsa1024")
+	assert.ErrorContains(t, errUnsupported, `unsupported key type "dsa1024"`)
+}
+
+func TestKeyTypeOfUnknown(t *testing.T) {
+	rsaKey, errRSA := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, errRSA)
+	assert.Equal(t, KeyType(""), KeyTypeOf(rsaKey.Public()))
+	ecKey, errEC := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	require.NoError(t, errEC)
+	assert.Equal(t, KeyType(""), KeyTypeOf(ecKey.Public()))
+	assert.Equal(t, KeyType(""), KeyTypeOf("not a key"))
+	assert.Equal(t, "unknown string", describeKey("not a key"))
+}
+
+func TestParseKeyType(t *testing.T) {
+	for _, keyType := range KeyTypes {
+		parsed, errParse := ParseKeyType(string(keyType))
+		require.NoError(t, errParse)
+		assert.Equal(t, keyType, parsed)
+	}
+	parsed, errParse := ParseKeyType("ECDSA-P384")
+	require.NoError(t, errParse)
+	assert.Equal(t, KeyTypeECDSAP384, parsed)
+	_, errUnsupported := ParseKeyType("rsa1024")
+	assert.ErrorContains(t, errUnsupported, "use one of rsa2048, rsa4096, ecdsa-p256, ecdsa-p384, ed25519")
+}
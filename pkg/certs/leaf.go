@@ -0,0 +1,280 @@
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"time"
+)
+
+// LeafValidity leaf certificates are short lived, trust is established through the CA
+const LeafValidity = 30 * 24 * time.Hour
+
+// LeafConfig parameters for issued leaf certificates, zero values fall back to defaults
+type LeafConfig struct {
+	KeyType  KeyType
+	Validity time.Duration
+	// Subject fields, the common name defaults to the first host
+	CommonName         string
+	Organization       []string
+	OrganizationalUnit []string
+	Country            []string
+	Locality           []string
+	// ExtraSANs host names and ip addresses, that are added to every certificate
+	ExtraSANs []string
+	// ExtKeyUsage defaults to server auth
+	ExtKeyUsage []x509.ExtKeyUsage
+}
+
+// Hosts the hosts a certificate is issued for including the extra SANs
+func (c LeafConfig) Hosts(hosts []string) []string {
+	all := []string{}
+	seen := map[string]bool{}
+	for _, h := range append(append([]string{}, hosts...), c.ExtraSANs...) {
+		if !seen[h] {
+			seen[h] = true
+			all = append(all, h)
+		}
+	}
+	return all
+}
+
+// Issue a certificate for the given hosts and ip addresses signed by the CA
+func (ca *CA) Issue(hosts []string, config LeafConfig) (certPEM, keyPEM []byte, err error) {
+	hosts = config.Hosts(hosts)
+	if len(hosts) == 0 {
+		return nil, nil, errors.New("can not issue a certificate without hosts")
+	}
+	key, errKey := GenerateKey(config.KeyType)
+	if errKey != nil {
+		return nil, nil, fmt.Errorf("failed to generate private key: %w", errKey)
+	}
+	serialNumber, errSerial := newSerialNumber()
+	if errSerial != nil {
+		return nil, nil, errSerial
+	}
+	validity := config.Validity
+	if validity <= 0 {
+		validity = LeafValidity
+	}
+	notBefore := time.Now().Add(-time.Hour)
+	notAfter := notBefore.Add(validity)
+	if notAfter.After(ca.Cert.NotAfter) {
+		notAfter = ca.Cert.NotAfter
+	}
+	subject := pkix.Name{
+		Organization:       config.Organization,
+		OrganizationalUnit: config.OrganizationalUnit,
+		Country:            config.Country,
+		Locality:           config.Locality,
+		CommonName:         config.CommonName,
+	}
+	if len(subject.Organization) == 0 {
+		subject.Organization = []string{"webgrapple"}
+	}
+	if subject.CommonName == "" {
+		subject.CommonName = hosts[0]
+	}
+	extKeyUsage := config.ExtKeyUsage
+	if len(extKeyUsage) == 0 {
+		extKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+	keyUsage := x509.KeyUsageDigitalSignature
+	if _, isRSA := key.Public().(*rsa.PublicKey); isRSA {
+		// legacy clients use rsa key exchange
+		keyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               subject,
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              keyUsage,
+		ExtKeyUsage:           extKeyUsage,
+		BasicConstraintsValid: true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+	derBytes, errCreate := x509.CreateCertificate(rand.Reader, template, ca.Cert, key.Public(), ca.Key)
+	if errCreate != nil {
+		return nil, nil, fmt.Errorf("failed to create certificate: %w", errCreate)
+	}
+	keyPEM, err = encodePrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return encodeCertificate(derBytes), keyPEM, nil
+}
+
+// ReadCertificate read the first certificate from a PEM file
+func ReadCertificate(file string) (*x509.Certificate, error) {
+	pemBytes, errRead := os.ReadFile(file)
+	if errRead != nil {
+		return nil, errRead
+	}
+	return ParseCertificate(pemBytes)
+}
+
+// ParseCertificate parse the first certificate from PEM data
+func ParseCertificate(pemBytes []byte) (*x509.Certificate, error) {
+	for {
+		var block *pem.Block
+		block, pemBytes = pem.Decode(pemBytes)
+		if block == nil {
+			return nil, errors.New("no certificate found in PEM data")
+		}
+		if block.Type == "CERTIFICATE" {
+			return x509.ParseCertificate(block.Bytes)
+		}
+	}
+}
+
+// ReadPrivateKey read a PKCS8, PKCS1 or EC private key from a PEM file
+func ReadPrivateKey(file string) (crypto.Signer, error) {
+	pemBytes, errRead := os.ReadFile(file)
+	if errRead != nil {
+		return nil, errRead
+	}
+	key, errParse := ParsePrivateKey(pemBytes)
+	if errParse != nil {
+		return nil, fmt.Errorf("could not parse private key %q: %w", file, errParse)
+	}
+	return key, nil
+}
+
+// ParsePrivateKey parse a PKCS8, PKCS1 or EC private key from PEM data
+func ParsePrivateKey(pemBytes []byte) (crypto.Signer, error) {
+	for {
+		var block *pem.Block
+		block, pemBytes = pem.Decode(pemBytes)
+		if block == nil {
+			return nil, errors.New("no private key found in PEM data")
+		}
+		switch block.Type {
+		case "PRIVATE KEY":
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			signer, ok := key.(crypto.Signer)
+			if !ok {
+				return nil, errors.New("private key can not sign")
+			}
+			return signer, nil
+		case "RSA PRIVATE KEY":
+			return x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			return x509.ParseECPrivateKey(block.Bytes)
+		}
+	}
+}
+
+// PublicKeysEqual compare two public keys
+func PublicKeysEqual(a, b crypto.PublicKey) bool {
+	type equaler interface {
+		Equal(x crypto.PublicKey) bool
+	}
+	switch key := a.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		if e, ok := key.(equaler); ok {
+			return e.Equal(b)
+		}
+	}
+	return false
+}
+
+// WriteCertAndKey write cert and key PEM data, the key will only be readable by the user,
+// symlinks are not followed
+func WriteCertAndKey(certFile, keyFile string, certPEM, keyPEM []byte) error {
+	if err := writeFileExclusive(keyFile, keyPEM, 0o600); err != nil {
+		return fmt.Errorf("failed to write key: %w", err)
+	}
+	if err := writeFileExclusive(certFile, certPEM, 0o644); err != nil {
+		return fmt.Errorf("failed to write cert: %w", err)
+	}
+	return nil
+}
+
+// NeedsRenewal tells if less than a third of the certificates lifetime is left
+func NeedsRenewal(cert *x509.Certificate, now time.Time) bool {
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	return now.After(cert.NotAfter.Add(-lifetime / 3))
+}
+
+// CheckLeaf make sure, that a cert and key pair is usable for the given hosts and matches the config,
+// returns what is wrong with it
+func CheckLeaf(certFile, keyFile string, hosts []string, config LeafConfig, now time.Time) error {
+	cert, errCert := ReadCertificate(certFile)
+	if errCert != nil {
+		return fmt.Errorf("can not read cert: %w", errCert)
+	}
+	key, errKey := ReadPrivateKey(keyFile)
+	if errKey != nil {
+		return fmt.Errorf("can not read key: %w", errKey)
+	}
+	switch {
+	case !PublicKeysEqual(cert.PublicKey, key.Public()):
+		return errors.New("key does not match the cert")
+	case now.Before(cert.NotBefore):
+		return fmt.Errorf("cert is not valid before %s", cert.NotBefore)
+	case now.After(cert.NotAfter):
+		return fmt.Errorf("cert expired at %s", cert.NotAfter)
+	case NeedsRenewal(cert, now):
+		return fmt.Errorf("cert is about to expire at %s", cert.NotAfter)
+	case config.KeyType != "" && KeyTypeOf(cert.PublicKey) != config.KeyType:
+		return fmt.Errorf("cert key is %s, not %s", describeKey(cert.PublicKey), config.KeyType)
+	}
+	for _, host := range config.Hosts(hosts) {
+		if errVerify := cert.VerifyHostname(host); errVerify != nil {
+			return fmt.Errorf("cert does not cover %q", host)
+		}
+	}
+	return checkLeafConfig(cert, config)
+}
+
+// checkLeafConfig compare a certificate with the configured fields, unconfigured ones are not checked
+func checkLeafConfig(cert *x509.Certificate, config LeafConfig) error {
+	if config.Validity > 0 {
+		// issuing backdates by an hour, allow for a little clock skew
+		lifetime := cert.NotAfter.Sub(cert.NotBefore)
+		if diff := lifetime - config.Validity; diff > time.Minute || diff < -time.Minute {
+			return fmt.Errorf("cert is valid for %s, not %s", lifetime, config.Validity)
+		}
+	}
+	if config.CommonName != "" && cert.Subject.CommonName != config.CommonName {
+		return fmt.Errorf("cert common name is %q, not %q", cert.Subject.CommonName, config.CommonName)
+	}
+	for _, field := range []struct {
+		name       string
+		configured []string
+		actual     []string
+	}{
+		{name: "organization", configured: config.Organization, actual: cert.Subject.Organization},
+		{name: "organizational unit", configured: config.OrganizationalUnit, actual: cert.Subject.OrganizationalUnit},
+		{name: "country", configured: config.Country, actual: cert.Subject.Country},
+		{name: "locality", configured: config.Locality, actual: cert.Subject.Locality},
+	} {
+		if len(field.configured) > 0 && !slices.Equal(field.configured, field.actual) {
+			return fmt.Errorf("cert %s is %q, not %q", field.name, field.actual, field.configured)
+		}
+	}
+	if len(config.ExtKeyUsage) > 0 && !slices.Equal(config.ExtKeyUsage, cert.ExtKeyUsage) {
+		return fmt.Errorf("cert extended key usage is %q, not %q", extKeyUsageList(cert.ExtKeyUsage), extKeyUsageList(config.ExtKeyUsage))
+	}
+	return nil
+}
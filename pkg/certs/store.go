@@ -0,0 +1,96 @@
+package certs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DefaultStateDir where generated leaf certificates live, $XDG_STATE_HOME/webgrapple/certs
+// or ~/.local/state/webgrapple/certs
+func DefaultStateDir() (string, error) {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" || !filepath.IsAbs(stateHome) {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("could not determine user home dir: %w", err)
+		}
+		stateHome = filepath.Join(homeDir, ".local", "state")
+	}
+	return filepath.Join(stateHome, "webgrapple", "certs"), nil
+}
+
+// EnsurePrivateDir create dir with 0700, an existing dir must be owned by the current user
+// and must not be a symlink, group and other permissions will be removed
+func EnsurePrivateDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("could not create dir %q: %w", dir, err)
+	}
+	info, errStat := os.Lstat(dir)
+	if errStat != nil {
+		return errStat
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%q is not a directory", dir)
+	}
+	if errOwner := checkOwner(info); errOwner != nil {
+		return fmt.Errorf("refusing to use dir %q: %w", dir, errOwner)
+	}
+	if info.Mode().Perm()&groupOtherPerm != 0 {
+		if err := os.Chmod(dir, 0o700); err != nil {
+			return fmt.Errorf("could not restrict permissions of %q: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// CheckPrivateFile make sure file is a regular file owned by the current user, that nobody else can access
+func CheckPrivateFile(file string) error {
+	info, errStat := os.Lstat(file)
+	if errStat != nil {
+		return errStat
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%q is not a regular file", file)
+	}
+	if errOwner := checkOwner(info); errOwner != nil {
+		return fmt.Errorf("%q: %w", file, errOwner)
+	}
+	if info.Mode().Perm()&groupOtherPerm != 0 {
+		return fmt.Errorf("%q is accessible by other users (%s)", file, info.Mode().Perm())
+	}
+	return nil
+}
+
+// writeFileExclusive write data through a new temporary file next to file, which is renamed into place,
+// the temporary file is created exclusively and symlinks are never followed
+func writeFileExclusive(file string, data []byte, perm os.FileMode) error {
+	if info, errStat := os.Lstat(file); errStat == nil && info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("refusing to write %q, it is a symlink", file)
+	}
+	tmpFile := file + ".tmp"
+	f, errOpen := os.OpenFile(tmpFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL|openNoFollow, perm)
+	if errors.Is(errOpen, os.ErrExist) {
+		// left over from a crashed write, never reuse it
+		if errRemove := os.Remove(tmpFile); errRemove != nil {
+			return errRemove
+		}
+		f, errOpen = os.OpenFile(tmpFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL|openNoFollow, perm)
+	}
+	if errOpen != nil {
+		return errOpen
+	}
+	_, errWrite := f.Write(data)
+	errClose := f.Close()
+	if errWrite == nil {
+		errWrite = errClose
+	}
+	if errWrite == nil {
+		errWrite = os.Rename(tmpFile, file)
+	}
+	if errWrite != nil {
+		_ = os.Remove(tmpFile)
+	}
+	return errWrite
+}
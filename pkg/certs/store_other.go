@@ -0,0 +1,17 @@
+//go:build !unix
+
+package certs
+
+import "os"
+
+const (
+	// there is no O_NOFOLLOW, writeFileExclusive still refuses existing symlinks
+	openNoFollow = 0
+	// file modes do not reflect ACLs
+	groupOtherPerm = os.FileMode(0)
+)
+
+// ownership is not checked, the user profile dirs are private by default
+func checkOwner(info os.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,44 @@
+//go:build unix
+
+package certs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteCertAndKeyRefusesSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	victim := filepath.Join(dir, "victim")
+	require.NoError(t, os.WriteFile(victim, []byte("keep me"), 0o600))
+	keyFile := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.Symlink(victim, keyFile))
+
+	assert.Error(t, WriteCertAndKey(filepath.Join(dir, "cert.pem"), keyFile, []byte("cert"), []byte("key")))
+	victimBytes, errRead := os.ReadFile(victim)
+	require.NoError(t, errRead)
+	assert.Equal(t, "keep me", string(victimBytes))
+
+	require.NoError(t, os.Remove(keyFile))
+	require.NoError(t, WriteCertAndKey(filepath.Join(dir, "cert.pem"), keyFile, []byte("cert"), []byte("key")))
+	assert.NoError(t, CheckPrivateFile(keyFile))
+}
+
+func TestEnsurePrivateDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "certs")
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	require.NoError(t, os.Chmod(dir, 0o755))
+	require.NoError(t, EnsurePrivateDir(dir))
+	info, errStat := os.Stat(dir)
+	require.NoError(t, errStat)
+	assert.Equal(t, os.FileMode(0o700), info.Mode().Perm())
+
+	file := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(file, []byte("key"), 0o644))
+	require.NoError(t, os.Chmod(file, 0o644))
+	assert.Error(t, CheckPrivateFile(file))
+}
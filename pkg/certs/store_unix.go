@@ -0,0 +1,25 @@
+//go:build unix
+
+package certs
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+const (
+	openNoFollow   = syscall.O_NOFOLLOW
+	groupOtherPerm = os.FileMode(0o077)
+)
+
+func checkOwner(info os.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	if uid := os.Getuid(); int(stat.Uid) != uid {
+		return fmt.Errorf("owned by uid %d and not by the current user %d", stat.Uid, uid)
+	}
+	return nil
+}
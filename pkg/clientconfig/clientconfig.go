@@ -1,7 +1,7 @@
 package clientconfig
 
 import (
-	"errors"
+	"fmt"
 	"os"
 
 	"github.com/foomo/webgrapple/pkg/vo"
@@ -13,23 +13,42 @@ func ReadConfig(file string) (multiServerConfig vo.ClientConfig, err error) {
 	if errRead != nil {
 		return nil, errRead
 	}
-	return readConfigBytes(configBytes)
+	return readConfigFile(file, configBytes)
 }
 
 func readConfigBytes(configBytes []byte) (vo.ClientConfig, error) {
-	// a list of services
-	clientConfig := vo.ClientConfig{}
-	if yaml.Unmarshal(configBytes, &clientConfig) == nil {
-		return clientConfig, nil
-	}
+	return readConfigFile("webgrapple.yaml", configBytes)
+}
 
-	// just one service
-	var service *vo.Service
-	if yaml.Unmarshal(configBytes, &service) == nil {
-		return vo.ClientConfig{
-			service,
-		}, nil
+// readConfigFile a versioned config is validated strictly, without a version it is
+// a list of services or just one service
+func readConfigFile(file string, configBytes []byte) (vo.ClientConfig, error) {
+	document := &yaml.Node{}
+	if errUnmarshal := yaml.Unmarshal(configBytes, document); errUnmarshal != nil {
+		return nil, fmt.Errorf("%s: %w", file, errUnmarshal)
+	}
+	if len(document.Content) == 0 {
+		return vo.ClientConfig{}, nil
+	}
+	root := document.Content[0]
+	switch {
+	case root.Kind == yaml.MappingNode && mappingValue(root, "version") != nil:
+		return readConfigV2(file, root)
+	case root.Kind == yaml.SequenceNode:
+		// a list of services
+		clientConfig := vo.ClientConfig{}
+		if errDecode := root.Decode(&clientConfig); errDecode != nil {
+			return nil, fmt.Errorf("%s: %w", file, errDecode)
+		}
+		return clientConfig, nil
+	case root.Kind == yaml.MappingNode:
+		// just one service
+		service := &vo.Service{}
+		if errDecode := root.Decode(service); errDecode != nil {
+			return nil, fmt.Errorf("%s: %w", file, errDecode)
+		}
+		return vo.ClientConfig{service}, nil
+	default:
+		return nil, fmt.Errorf("%s:%d:%d: expected a list of services, one service or a config with a version", file, root.Line, root.Column)
 	}
-
-	return nil, errors.New("all attempts to read config failed")
 }
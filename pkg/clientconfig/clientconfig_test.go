@@ -1,6 +1,8 @@
 package clientconfig
 
 import (
+	"encoding/json"
+	"reflect"
 	"testing"
 
 	"github.com/foomo/webgrapple/pkg/vo"
@@ -30,3 +32,226 @@ func TestReadConfigService(t *testing.T) {
 	require.NoError(t, errRead)
 	assert.Equal(t, vo.ServiceID("my-service"), serviceConfigService[0].ID)
 }
+
+func TestReadConfigServiceCommands(t *testing.T) {
+	config, errRead := readConfigBytes([]byte(`
+- id: storefront
+  dir: apps/storefront
+  command: [yarn, dev]
+  env:
+    NODE_ENV: development
+`))
+	require.NoError(t, errRead)
+	require.Len(t, config, 1)
+	assert.Equal(t, []string{"yarn", "dev"}, config[0].Command)
+	assert.Equal(t, "apps/storefront", config[0].Dir)
+	assert.Equal(t, map[string]string{"NODE_ENV": "development"}, config[0].Env)
+}
+
+func TestReadConfigV2(t *testing.T) {
+	config, errRead := readConfigBytes([]byte(`
+version: 2
+services:
+  - id: storefront
+    type: npm
+    routes: [/shop, /api/cart]
+    headers:
+      X-Forwarded-Prefix: /shop
+    healthCheck:
+      path: /healthz
+    command: [yarn, dev]
+    env:
+      PORT_OFFSET: 1
+  - id: cms
+    type: remote
+    address: http://127.0.0.1:8080
+    custom:
+      site: de
+`))
+	require.NoError(t, errRead)
+	require.Len(t, config, 2)
+	assert.Equal(t, &vo.Service{
+		ID:         "storefront",
+		Type:       vo.ServiceTypeNPM,
+		Routes:     []string{"/shop", "/api/cart"},
+		Headers:    map[string]string{"X-Forwarded-Prefix": "/shop"},
+		HealthPath: "/healthz",
+		Command:    []string{"yarn", "dev"},
+		Env:        map[string]string{"PORT_OFFSET": "1"},
+	}, config[0])
+	assert.Equal(t, "http://127.0.0.1:8080", config[1].Address)
+	assert.Equal(t, map[string]interface{}{"site": "de"}, config[1].Custom)
+}
+
+func TestReadConfigV2Strict(t *testing.T) {
+	_, errRead := readConfigBytes([]byte(`version: 2
+services:
+  - id: storefront
+    adress: http://127.0.0.1:3000
+    routes: shop
+    type: docker
+  - id: storefront
+    healthCheck:
+      path: healthz
+`))
+	errValidation := &ValidationError{}
+	require.ErrorAs(t, errRead, &errValidation)
+	assert.Equal(t, `webgrapple.yaml:4:5: unknown field "adress" in services[0], did you mean "address"?
+webgrapple.yaml:5:13: services[0].routes must be a list`, errValidation.Error())
+
+	_, errRead = readConfigBytes([]byte(`version: 2
+services:
+  - id: storefront
+    type: docker
+    address: localhost:3000
+  - id: storefront
+    healthCheck:
+      path: healthz
+`))
+	require.ErrorAs(t, errRead, &errValidation)
+	assert.Equal(t, []Problem{
+		{Line: 4, Column: 11, Message: `unknown service type "docker", use one of exec, npm, remote`},
+		{Line: 5, Column: 14, Message: `address "localhost:3000" must be a http or https url`},
+		{Line: 6, Column: 9, Message: `service id "storefront" is used more than once`},
+		{Line: 8, Column: 13, Message: `health check path "healthz" must start with /`},
+	}, errValidation.Problems)
+
+	_, errRead = readConfigBytes([]byte("version: 3\n"))
+	assert.EqualError(t, errRead, "webgrapple.yaml:1:10: unsupported version 3, the current version is 2")
+
+	_, errRead = readConfigBytes([]byte("- id: [broken\n"))
+	assert.ErrorContains(t, errRead, "line 1")
+}
+
+func TestSchema(t *testing.T) {
+	schema := struct {
+		Definitions map[string]struct {
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"definitions"`
+	}{}
+	require.NoError(t, json.Unmarshal(Schema, &schema))
+	for definition, v := range map[string]interface{}{
+		"configV2":  configV2{},
+		"serviceV2": serviceV2{},
+	} {
+		fields := []string{}
+		rt := reflect.TypeOf(v)
+		for i := range rt.NumField() {
+			fields = append(fields, rt.Field(i).Tag.Get("yaml"))
+		}
+		properties := []string{}
+		for property := range schema.Definitions[definition].Properties {
+			properties = append(properties, property)
+		}
+		assert.ElementsMatch(t, fields, properties, definition)
+	}
+}
+
+func TestReadConfigV2AliasesAndMerges(t *testing.T) {
+	_, errRead := readConfigBytes([]byte(`version: 2
+x-defaults: &defaults
+  type: npm
+  env: &env
+    NODE_ENV: development
+services:
+  - &storefront
+    <<: *defaults
+    id: storefront
+    routes: [/shop]
+  - <<: [*storefront, *defaults]
+    id: checkout
+    env: *env
+    routes: &routes [/checkout]
+  - *storefront
+`))
+	// top level extensions are unknown fields
+	errValidation := &ValidationError{}
+	require.ErrorAs(t, errRead, &errValidation)
+	assert.Equal(t, `webgrapple.yaml:2:1: unknown field "x-defaults" in the config`, errValidation.Error())
+
+	config, errRead := readConfigBytes([]byte(`version: 2
+services:
+  - &storefront
+    <<: &defaults
+      type: npm
+      env:
+        NODE_ENV: development
+    id: storefront
+    routes: [/shop]
+  - <<: [*storefront, *defaults]
+    id: checkout
+    routes: [/checkout]
+`))
+	require.NoError(t, errRead)
+	require.Len(t, config, 2)
+	for i, id := range []vo.ServiceID{"storefront", "checkout"} {
+		assert.Equal(t, id, config[i].ID)
+		assert.Equal(t, vo.ServiceTypeNPM, config[i].Type)
+		assert.Equal(t, map[string]string{"NODE_ENV": "development"}, config[i].Env)
+	}
+	assert.Equal(t, []string{"/checkout"}, config[1].Routes)
+
+	// problems inside aliased and merged nodes are found
+	_, errRead = readConfigBytes([]byte(`version: 2
+services:
+  - &storefront
+    id: storefront
+    type: docker
+    routes: [shop]
+    headers:
+      "bad header": x
+  - *storefront
+  - <<: *storefront
+    adress: http://127.0.0.1:3000
+  - <<: [*storefront, broken]
+    id: checkout
+`))
+	require.ErrorAs(t, errRead, &errValidation)
+	assert.Equal(t, []Problem{
+		{Line: 11, Column: 5, Message: `unknown field "adress" in services[2], did you mean "address"?`},
+		{Line: 12, Column: 5, Message: `<< in services[3] must merge a mapping or a list of mappings`},
+	}, errValidation.Problems)
+
+	_, errRead = readConfigBytes([]byte(`version: 2
+services:
+  - &storefront
+    id: storefront
+    type: docker
+    routes: [shop]
+    headers:
+      "bad header": x
+  - *storefront
+  - <<: *storefront
+    id: checkout
+`))
+	require.ErrorAs(t, errRead, &errValidation)
+	assert.Equal(t, []Problem{
+		{Line: 5, Column: 11, Message: `unknown service type "docker", use one of exec, npm, remote`},
+		{Line: 6, Column: 14, Message: `route "shop" must start with /`},
+		{Line: 8, Column: 7, Message: `invalid header name "bad header"`},
+		{Line: 4, Column: 9, Message: `service id "storefront" is used more than once`},
+		{Line: 5, Column: 11, Message: `unknown service type "docker", use one of exec, npm, remote`},
+		{Line: 6, Column: 14, Message: `route "shop" must start with /`},
+		{Line: 8, Column: 7, Message: `invalid header name "bad header"`},
+		{Line: 5, Column: 11, Message: `unknown service type "docker", use one of exec, npm, remote`},
+		{Line: 6, Column: 14, Message: `route "shop" must start with /`},
+		{Line: 8, Column: 7, Message: `invalid header name "bad header"`},
+	}, errValidation.Problems)
+}
+
+func TestReadConfigV2Version(t *testing.T) {
+	for config, position := range map[string]string{
+		"version:\nservices: []\n": "1:9",
+		"version: ~\n":             "1:10",
+		"version: null\n":          "1:10",
+	} {
+		_, errRead := readConfigBytes([]byte(config))
+		assert.EqualError(t, errRead, "webgrapple.yaml:"+position+": version is required, the current version is 2", config)
+	}
+	_, errRead := readConfigBytes([]byte("version: \"2\"\n"))
+	assert.EqualError(t, errRead, "webgrapple.yaml:1:10: version must be a number")
+
+	errValidation := &ValidationError{File: "webgrapple.yaml"}
+	errValidation.add(nil, "no position")
+	assert.EqualError(t, errValidation, "webgrapple.yaml: no position")
+}
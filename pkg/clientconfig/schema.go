@@ -0,0 +1,389 @@
+package clientconfig
+
+import (
+	_ "embed"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/foomo/webgrapple/pkg/vo"
+	"gopkg.in/yaml.v3"
+)
+
+// Version the current version of webgrapple.yaml, files without a version are a list of services or one service
+const Version = 2
+
+// Schema JSON Schema of webgrapple.yaml for editors, e.g. with a
+// "# yaml-language-server: $schema=<path to webgrapple.schema.json>" comment
+//
+//go:embed webgrapple.schema.json
+var Schema []byte
+
+var (
+	headerNameRe = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+	envVarNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+	serviceTypes = []string{vo.ServiceTypeExec, vo.ServiceTypeNPM, vo.ServiceTypeRemote}
+)
+
+// configV2 webgrapple.yaml with a version
+type configV2 struct {
+	Version  int         `yaml:"version"`
+	Services []serviceV2 `yaml:"services"`
+}
+
+type serviceV2 struct {
+	ID          vo.ServiceID           `yaml:"id"`
+	Type        string                 `yaml:"type"`
+	Address     string                 `yaml:"address"`
+	Routes      []string               `yaml:"routes"`
+	Headers     map[string]string      `yaml:"headers"`
+	HealthCheck *healthCheckV2         `yaml:"healthCheck"`
+	Command     []string               `yaml:"command"`
+	Dir         string                 `yaml:"dir"`
+	EnvFiles    []string               `yaml:"envFiles"`
+	Env         map[string]string      `yaml:"env"`
+	Watch       []string               `yaml:"watch"`
+	Custom      map[string]interface{} `yaml:"custom"`
+}
+
+type healthCheckV2 struct {
+	// Path http path, that answers without a server error, when the service is ready
+	Path string `yaml:"path"`
+}
+
+func (s serviceV2) service() *vo.Service {
+	service := &vo.Service{
+		ID:       s.ID,
+		Type:     s.Type,
+		Address:  s.Address,
+		Routes:   s.Routes,
+		Headers:  s.Headers,
+		Command:  s.Command,
+		Dir:      s.Dir,
+		EnvFiles: s.EnvFiles,
+		Env:      s.Env,
+		Watch:    s.Watch,
+		Custom:   s.Custom,
+	}
+	if s.HealthCheck != nil {
+		service.HealthPath = s.HealthCheck.Path
+	}
+	return service
+}
+
+// Problem something wrong at a position in a config file
+type Problem struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+// ValidationError all problems of a config file
+type ValidationError struct {
+	File     string
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Problems))
+	for _, p := range e.Problems {
+		if p.Line == 0 {
+			lines = append(lines, fmt.Sprintf("%s: %s", e.File, p.Message))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s:%d:%d: %s", e.File, p.Line, p.Column, p.Message))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// add a problem at node, without a node the problem has no position
+func (e *ValidationError) add(node *yaml.Node, format string, a ...interface{}) {
+	problem := Problem{Message: fmt.Sprintf(format, a...)}
+	if node != nil {
+		problem.Line, problem.Column = node.Line, node.Column
+	}
+	e.Problems = append(e.Problems, problem)
+}
+
+// validateNode check a yaml node strictly against the yaml fields of t
+func (e *ValidationError) validateNode(node *yaml.Node, t reflect.Type, path string) {
+	node = resolve(node)
+	if isNull(node) {
+		return
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			e.add(node, "%s must be a mapping", pathName(path))
+			return
+		}
+		fields := map[string]reflect.Type{}
+		for i := range t.NumField() {
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+			fields[name] = t.Field(i).Type
+		}
+		seen := map[string]bool{}
+		for _, pair := range e.pairs(node, path) {
+			key, value := pair.key, pair.value
+			fieldType, ok := fields[key.Value]
+			switch {
+			case seen[key.Value] && pair.merged:
+				// overridden
+			case !ok:
+				e.add(key, "unknown field %q in %s%s", key.Value, pathName(path), suggest(key.Value, fields))
+			case seen[key.Value]:
+				e.add(key, "%s is set more than once", joinPath(path, key.Value))
+			default:
+				seen[key.Value] = true
+				e.validateNode(value, fieldType, joinPath(path, key.Value))
+			}
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			e.add(node, "%s must be a mapping", path)
+			return
+		}
+		for _, pair := range e.pairs(node, path) {
+			key, value := pair.key, pair.value
+			if key.Kind != yaml.ScalarNode {
+				e.add(key, "keys of %s must be strings", path)
+				continue
+			}
+			if t.Elem().Kind() != reflect.Interface {
+				e.validateNode(value, t.Elem(), joinPath(path, key.Value))
+			}
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			e.add(node, "%s must be a list", path)
+			return
+		}
+		for i, element := range node.Content {
+			e.validateNode(element, t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+		}
+	case reflect.String:
+		if node.Kind != yaml.ScalarNode {
+			e.add(node, "%s must be a string", path)
+		}
+	case reflect.Int:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!int" {
+			e.add(node, "%s must be a number", path)
+		}
+	}
+}
+
+// pairs of a mapping node, broken merge keys are problems
+func (e *ValidationError) pairs(node *yaml.Node, path string) []mappingPair {
+	pairs, invalid := mappingPairs(node)
+	for _, key := range invalid {
+		e.add(key, "<< in %s must merge a mapping or a list of mappings", pathName(path))
+	}
+	return pairs
+}
+
+// pathName a path for messages, the empty path is the config itself
+func pathName(path string) string {
+	if path == "" {
+		return "the config"
+	}
+	return path
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// suggest a known field for a typo
+func suggest(name string, fields map[string]reflect.Type) string {
+	best, bestDistance := "", 3
+	for field := range fields {
+		if d := distance(strings.ToLower(name), strings.ToLower(field)); d < bestDistance || (d == bestDistance && field < best) {
+			best, bestDistance = field, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean %q?", best)
+}
+
+// distance levenshtein distance of a and b
+func distance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+// resolve follow aliases to the node they point to
+func resolve(node *yaml.Node) *yaml.Node {
+	for node != nil && node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
+
+func isNull(node *yaml.Node) bool {
+	return node == nil || (node.Kind == yaml.ScalarNode && node.Tag == "!!null")
+}
+
+// mappingPair a key and its value, merged pairs come from a << merge key
+type mappingPair struct {
+	key    *yaml.Node
+	value  *yaml.Node
+	merged bool
+}
+
+// mappingPairs the pairs of a mapping node, << merge keys are expanded, the pairs of the mapping come first,
+// followed by the merged ones in the order they take precedence, merge keys, that do not merge mappings, are
+// returned as invalid
+func mappingPairs(node *yaml.Node) (pairs []mappingPair, invalid []*yaml.Node) {
+	node = resolve(node)
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	merged := []mappingPair{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], resolve(node.Content[i+1])
+		if key.Tag != "!!merge" {
+			pairs = append(pairs, mappingPair{key: key, value: value})
+			continue
+		}
+		sources := []*yaml.Node{value}
+		if value.Kind == yaml.SequenceNode {
+			sources = value.Content
+		}
+		for _, source := range sources {
+			if resolve(source).Kind != yaml.MappingNode {
+				invalid = append(invalid, key)
+				continue
+			}
+			sourcePairs, sourceInvalid := mappingPairs(source)
+			for _, pair := range sourcePairs {
+				pair.merged = true
+				merged = append(merged, pair)
+			}
+			invalid = append(invalid, sourceInvalid...)
+		}
+	}
+	return append(pairs, merged...), invalid
+}
+
+// mappingValue the value of key in a mapping node, aliases are resolved and merge keys are honored
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	pairs, _ := mappingPairs(node)
+	for _, pair := range pairs {
+		if pair.key.Value == key {
+			return pair.value
+		}
+	}
+	return nil
+}
+
+// readConfigV2 strictly validate and read a versioned config
+func readConfigV2(file string, root *yaml.Node) (vo.ClientConfig, error) {
+	errValidation := &ValidationError{File: file}
+	errValidation.validateNode(root, reflect.TypeOf(configV2{}), "")
+	if len(errValidation.Problems) > 0 {
+		return nil, errValidation
+	}
+	switch version := mappingValue(root, "version"); {
+	case isNull(version):
+		errValidation.add(version, "version is required, the current version is %d", Version)
+		return nil, errValidation
+	case version.Value != fmt.Sprint(Version):
+		errValidation.add(version, "unsupported version %s, the current version is %d", version.Value, Version)
+		return nil, errValidation
+	}
+	config := configV2{}
+	if errDecode := root.Decode(&config); errDecode != nil {
+		return nil, fmt.Errorf("%s: %w", file, errDecode)
+	}
+
+	services := mappingValue(root, "services")
+	ids := map[vo.ServiceID]bool{}
+	clientConfig := vo.ClientConfig{}
+	for i, service := range config.Services {
+		node := resolve(services.Content[i])
+		if service.ID != "" {
+			if ids[service.ID] {
+				errValidation.add(mappingValue(node, "id"), "service id %q is used more than once", service.ID)
+			}
+			ids[service.ID] = true
+		}
+		validateService(errValidation, node, service)
+		clientConfig = append(clientConfig, service.service())
+	}
+	if len(errValidation.Problems) > 0 {
+		return nil, errValidation
+	}
+	return clientConfig, nil
+}
+
+// validateService the values of a service, that has the right shape
+func validateService(e *ValidationError, node *yaml.Node, service serviceV2) {
+	if service.Type != "" && !slices.Contains(serviceTypes, service.Type) {
+		e.add(mappingValue(node, "type"), "unknown service type %q, use one of %s", service.Type, strings.Join(serviceTypes, ", "))
+	}
+	if service.Type == vo.ServiceTypeRemote && service.Address == "" {
+		e.add(node, "a remote service needs an address")
+	}
+	if service.Type == vo.ServiceTypeRemote && len(service.Command) > 0 {
+		e.add(mappingValue(node, "command"), "a remote service has no command")
+	}
+	if service.Address != "" {
+		if serviceURL, errParse := url.Parse(service.Address); errParse != nil || (serviceURL.Scheme != "http" && serviceURL.Scheme != "https") || serviceURL.Host == "" {
+			e.add(mappingValue(node, "address"), "address %q must be a http or https url", service.Address)
+		}
+	}
+	for i, route := range service.Routes {
+		if !strings.HasPrefix(route, "/") {
+			e.add(mappingValue(node, "routes").Content[i], "route %q must start with /", route)
+		}
+	}
+	for _, name := range mappingKeys(mappingValue(node, "headers")) {
+		if !headerNameRe.MatchString(name.Value) {
+			e.add(name, "invalid header name %q", name.Value)
+		}
+	}
+	for _, name := range mappingKeys(mappingValue(node, "env")) {
+		if !envVarNameRe.MatchString(name.Value) {
+			e.add(name, "invalid env var name %q", name.Value)
+		}
+	}
+	if healthCheck := service.HealthCheck; healthCheck != nil && healthCheck.Path != "" && !strings.HasPrefix(healthCheck.Path, "/") {
+		e.add(mappingValue(mappingValue(node, "healthCheck"), "path"), "health check path %q must start with /", healthCheck.Path)
+	}
+}
+
+// mappingKeys the key nodes of a mapping node including merged ones
+func mappingKeys(node *yaml.Node) []*yaml.Node {
+	keys := []*yaml.Node{}
+	pairs, _ := mappingPairs(node)
+	for _, pair := range pairs {
+		keys = append(keys, pair.key)
+	}
+	return keys
+}
@@ -0,0 +1,284 @@
+package clientexec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/foomo/webgrapple/pkg/clientconfig"
+	"github.com/foomo/webgrapple/pkg/log"
+	"github.com/foomo/webgrapple/pkg/vo"
+)
+
+// Option configures optional behaviour of Run
+type Option func(o *options)
+
+type options struct {
+	port            int
+	configPath      string
+	env             []string
+	serviceIDPrefix string
+	readyTimeout    time.Duration
+	healthPath      string
+	supervisor      SupervisorConfig
+	gracePeriod     time.Duration
+	ignorePorts     []int
+	debugPort       int
+	publicURL       string
+	caCertFile      string
+	stdout          io.Writer
+	stderr          io.Writer
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		serviceIDPrefix: "exec-service-",
+		readyTimeout:    DefaultReadyTimeout,
+		supervisor:      DefaultSupervisorConfig(),
+		gracePeriod:     DefaultGracePeriod,
+		publicURL:       DefaultPublicURL,
+		stdout:          os.Stdout,
+		stderr:          os.Stderr,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithPort the port the command will listen on, if not set a free port is picked, both ways it is passed in PORT
+func WithPort(port int) Option {
+	return func(o *options) {
+		o.port = port
+	}
+}
+
+// WithConfigPath path to webgrapple.yaml, defaults to the one in the work dir
+func WithConfigPath(path string) Option {
+	return func(o *options) {
+		o.configPath = path
+	}
+}
+
+// WithEnv additional environment variables for the command in the form NAME=value
+func WithEnv(env ...string) Option {
+	return func(o *options) {
+		o.env = append(o.env, env...)
+	}
+}
+
+// WithServiceIDPrefix prefix for ids of services, that have none in the config, the work dir name is appended
+func WithServiceIDPrefix(prefix string) Option {
+	return func(o *options) {
+		o.serviceIDPrefix = prefix
+	}
+}
+
+// WithReadyTimeout how long to wait for services to listen, before giving up
+func WithReadyTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.readyTimeout = timeout
+	}
+}
+
+// WithHealthPath health path for services, that do not configure one, e.g. /healthz
+func WithHealthPath(path string) Option {
+	return func(o *options) {
+		o.healthPath = path
+	}
+}
+
+// WithSupervisor restart the command, when it exits, see SupervisorConfig
+func WithSupervisor(config SupervisorConfig) Option {
+	return func(o *options) {
+		o.supervisor = config
+	}
+}
+
+// WithGracePeriod how long the command may take to terminate after SIGTERM, before it is killed
+func WithGracePeriod(gracePeriod time.Duration) Option {
+	return func(o *options) {
+		o.gracePeriod = gracePeriod
+	}
+}
+
+// WithIgnorePorts ports, that the command listens on, but that are not its service, e.g. a debugger
+func WithIgnorePorts(ports ...int) Option {
+	return func(o *options) {
+		o.ignorePorts = append(o.ignorePorts, ports...)
+	}
+}
+
+// WithDebugPort the port of the commands inspector, it is not its service, the attach urls are looked up there
+func WithDebugPort(port int) Option {
+	return func(o *options) {
+		o.debugPort = port
+		o.ignorePorts = append(o.ignorePorts, port)
+	}
+}
+
+// WithPublicURL the url of the reverse proxy, that is passed in WEBGRAPPLE_PUBLIC_URL
+func WithPublicURL(publicURL string) Option {
+	return func(o *options) {
+		o.publicURL = publicURL
+	}
+}
+
+// WithCACertFile the CA cert passed in NODE_EXTRA_CA_CERTS, defaults to the local webgrapple CA
+func WithCACertFile(file string) Option {
+	return func(o *options) {
+		o.caCertFile = file
+	}
+}
+
+// WithOutput where the commands std out and std err go, defaults to the own std out and std err
+func WithOutput(stdout, stderr io.Writer) Option {
+	return func(o *options) {
+		o.stdout = stdout
+		o.stderr = stderr
+	}
+}
+
+// GetConfig read webgrapple.yaml from configPath or from the work dir
+func GetConfig(
+	l log.Logger,
+	workDir string,
+	configPath string,
+) (config vo.ClientConfig, err error) {
+	if configPath == "" {
+		configPath = filepath.Join(workDir, "webgrapple.yaml")
+	}
+
+	l.Info(fmt.Sprintf("checking for configuration at path %q", configPath))
+	info, errStat := os.Stat(configPath)
+	if errStat != nil || info.IsDir() {
+		return nil, errors.New("config is missing")
+	}
+	l.Info("reading configuration")
+	config, errConfig := clientconfig.ReadConfig(configPath)
+	if errConfig != nil {
+		return nil, fmt.Errorf("could not read config from file: %w", errConfig)
+	}
+	return config, nil
+}
+
+// resolveConfigDir the dir of webgrapple.yaml, relative paths in it are resolved there
+func resolveConfigDir(workDir, configPath string) string {
+	if configPath == "" {
+		return workDir
+	}
+	return filepath.Dir(configPath)
+}
+
+// Run the command and register the services from webgrapple.yaml with the reverse proxy, as soon as they
+// are listening, until the command exits or we are interrupted, then the services are removed again,
+// a failing command is reported as an *ExitError
+func Run(
+	ctx context.Context,
+	l log.Logger,
+	reverseProxyURL string,
+	workDir string,
+	command string,
+	args []string,
+	opts ...Option,
+) error {
+	o := newOptions(opts...)
+	name := filepath.Base(workDir)
+	l.Info(fmt.Sprintf("starting webgrapple client for app %s with configuration %q", name, o.configPath))
+	config, errGetConfig := GetConfig(l, workDir, o.configPath)
+	if errGetConfig != nil {
+		return fmt.Errorf("failed to get config webgrapple.yaml is missing ?!: %w", errGetConfig)
+	}
+
+	port := o.port
+	if port == 0 {
+		freePort, errFreePort := FreePort()
+		if errFreePort != nil {
+			return fmt.Errorf("could not find a free port: %w", errFreePort)
+		}
+		port = freePort
+	}
+
+	for _, service := range config {
+		if service.ID == "" {
+			service.ID = vo.ServiceID(o.serviceIDPrefix + name)
+		}
+		if service.Address == "" {
+			// gotta be me
+			service.Address = fmt.Sprint("http://127.0.0.1:", port)
+		}
+		if service.HealthPath == "" {
+			service.HealthPath = o.healthPath
+		}
+	}
+
+	id := vo.ServiceID(o.serviceIDPrefix + name)
+	if len(config) > 0 {
+		id = config[0].ID
+	}
+	env := commandEnv(o, reverseProxyURL, port, id)
+	for _, service := range config {
+		if errEnv := env.addService(service, resolveConfigDir(workDir, o.configPath)); errEnv != nil {
+			return errEnv
+		}
+	}
+
+	reg := newRegistration(l, reverseProxyURL)
+	defer reg.deregisterAll(context.WithoutCancel(ctx))
+
+	p := &process{
+		name:    name,
+		command: command,
+		args:    args,
+		dir:     workDir,
+		env:     env.vars,
+		config:  config,
+		stdout:  o.stdout,
+		stderr:  o.stderr,
+		forward: make(chan os.Signal, 1),
+		port:    port,
+		watch:   newWatcher(workDir, watchGlobs(config)),
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer handleSignals(l, cancel, p)()
+	go reg.watchProxy(ctx, proxyCheckInterval)
+
+	defer l.Info("terminating")
+	return p.run(ctx, l, o, reg)
+}
+
+// watchGlobs the globs to watch of all services
+func watchGlobs(config vo.ClientConfig) []string {
+	globs := []string{}
+	for _, service := range config {
+		globs = append(globs, service.Watch...)
+	}
+	return globs
+}
+
+// FreePort asks the kernel for a free open port that is ready to use.
+func FreePort() (int, error) {
+	a, err := net.ResolveTCPAddr("tcp", "localhost:0")
+	if err != nil {
+		return 0, err
+	}
+
+	l, err := net.ListenTCP("tcp", a)
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+
+	addr, ok := l.Addr().(*net.TCPAddr)
+	if !ok {
+		return 0, errors.New("could not resolve local address")
+	}
+	return addr.Port, nil
+}
@@ -0,0 +1,119 @@
+package clientexec
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/foomo/webgrapple/pkg/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testLogger struct{}
+
+func (testLogger) Info(a ...interface{})  {}
+func (testLogger) Error(a ...interface{}) {}
+
+// fakeProxy records the gotsrpc calls a client makes
+type fakeProxy struct {
+	lock  sync.Mutex
+	calls []string
+}
+
+func (p *fakeProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	p.lock.Lock()
+	p.calls = append(p.calls, strings.TrimPrefix(r.URL.Path, server.DefaultEndPoint+"/")+" "+string(body))
+	p.lock.Unlock()
+	_, _ = w.Write([]byte("[null]"))
+}
+
+func TestRun(t *testing.T) {
+	proxy := &fakeProxy{}
+	proxyServer := httptest.NewServer(proxy)
+	defer proxyServer.Close()
+
+	workDir := filepath.Join(t.TempDir(), "app")
+	require.NoError(t, os.MkdirAll(workDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(workDir, "webgrapple.yaml"), []byte("- {}\n"), 0o644))
+
+	// plays the dev server, that the command would start
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer service.Close()
+	port := service.Listener.Addr().(*net.TCPAddr).Port
+
+	stdout := &bytes.Buffer{}
+	errRun := Run(
+		context.Background(), testLogger{}, proxyServer.URL, workDir,
+		"sh", []string{"-c", "echo $PORT $GREETING; sleep 1"},
+		WithPort(port),
+		WithEnv("GREETING=hello"),
+		WithHealthPath("/healthz"),
+		WithOutput(stdout, io.Discard),
+	)
+	require.NoError(t, errRun)
+	assert.Equal(t, fmt.Sprint(port, " hello\n"), stdout.String())
+
+	require.Len(t, proxy.calls, 2)
+	assert.True(t, strings.HasPrefix(proxy.calls[0], "Upsert "), proxy.calls[0])
+	assert.Contains(t, proxy.calls[0], "exec-service-app")
+	assert.Contains(t, proxy.calls[0], fmt.Sprint("http://127.0.0.1:", port))
+	assert.True(t, strings.HasPrefix(proxy.calls[1], "Remove "), proxy.calls[1])
+	assert.Contains(t, proxy.calls[1], "exec-service-app")
+}
+
+func TestRunReadyTimeout(t *testing.T) {
+	proxy := &fakeProxy{}
+	proxyServer := httptest.NewServer(proxy)
+	defer proxyServer.Close()
+
+	workDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(workDir, "webgrapple.yaml"), []byte("- {}\n"), 0o644))
+	port, errPort := FreePort()
+	require.NoError(t, errPort)
+
+	start := time.Now()
+	errRun := Run(
+		context.Background(), testLogger{}, proxyServer.URL, workDir,
+		"sleep", []string{"10"},
+		WithPort(port),
+		WithReadyTimeout(500*time.Millisecond),
+	)
+	assert.Error(t, errRun)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Empty(t, proxy.calls)
+}
+
+func TestRunRestartsUntilCrashLoop(t *testing.T) {
+	proxy := &fakeProxy{}
+	proxyServer := httptest.NewServer(proxy)
+	defer proxyServer.Close()
+
+	workDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(workDir, "webgrapple.yaml"), []byte("- {}\n"), 0o644))
+
+	config := DefaultSupervisorConfig()
+	config.Policy = RestartOnFailure
+	config.InitialBackoff = 10 * time.Millisecond
+	config.MaxRestarts = 2
+	errRun := Run(
+		context.Background(), testLogger{}, proxyServer.URL, workDir,
+		"sh", []string{"-c", "echo run >> runs; exit 1"},
+		WithSupervisor(config),
+	)
+	require.Error(t, errRun)
+	runs, errRead := os.ReadFile(filepath.Join(workDir, "runs"))
+	require.NoError(t, errRead)
+	assert.Equal(t, "run\nrun\nrun\n", string(runs))
+}
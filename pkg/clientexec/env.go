@@ -0,0 +1,198 @@
+package clientexec
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/foomo/webgrapple/pkg/certs"
+	"github.com/foomo/webgrapple/pkg/vo"
+)
+
+// env vars, that webgrapple passes to every command
+const (
+	EnvPublicURL  = "WEBGRAPPLE_PUBLIC_URL"
+	EnvServiceID  = "WEBGRAPPLE_SERVICE_ID"
+	EnvServiceURL = "WEBGRAPPLE_SERVICE_URL"
+	envNodeCAs    = "NODE_EXTRA_CA_CERTS"
+)
+
+// DefaultPublicURL the default listener of the reverse proxy
+const DefaultPublicURL = "https://localhost"
+
+var (
+	envNameRe      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+	envReferenceRe = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_.]*)\}`)
+)
+
+// envVar a NAME=value pair from a dotenv file
+type envVar struct {
+	name  string
+	value string
+	// expand is false for single quoted values
+	expand bool
+}
+
+// parseEnvFile read a dotenv file with NAME=value lines, comments, an optional export
+// and single or double quoted values
+func parseEnvFile(r io.Reader) ([]envVar, error) {
+	vars := []envVar{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		text = strings.TrimPrefix(text, "export ")
+		name, value, ok := strings.Cut(text, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !envNameRe.MatchString(name) {
+			return nil, fmt.Errorf("line %d: expected NAME=value", line)
+		}
+		v := envVar{name: name, expand: true}
+		value = strings.TrimSpace(value)
+		switch {
+		case strings.HasPrefix(value, `"`):
+			end := strings.LastIndex(value, `"`)
+			if end == 0 {
+				return nil, fmt.Errorf("line %d: unterminated double quote", line)
+			}
+			v.value = strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`).Replace(value[1:end])
+		case strings.HasPrefix(value, "'"):
+			end := strings.LastIndex(value, "'")
+			if end == 0 {
+				return nil, fmt.Errorf("line %d: unterminated single quote", line)
+			}
+			v.value = value[1:end]
+			v.expand = false
+		default:
+			// inline comments need a space before the #
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+			v.value = value
+		}
+		vars = append(vars, v)
+	}
+	return vars, scanner.Err()
+}
+
+// expandEnv replace ${VAR} references, unknown vars are replaced with an empty string
+func expandEnv(value string, lookup func(name string) (string, bool)) string {
+	return envReferenceRe.ReplaceAllStringFunc(value, func(reference string) string {
+		v, _ := lookup(envReferenceRe.FindStringSubmatch(reference)[1])
+		return v
+	})
+}
+
+// environment env vars for a command on top of the own environment, later ones win
+type environment struct {
+	vars   []string
+	values map[string]string
+}
+
+func newEnvironment(vars ...string) *environment {
+	e := &environment{values: map[string]string{}}
+	for _, v := range os.Environ() {
+		if name, value, ok := strings.Cut(v, "="); ok {
+			e.values[name] = value
+		}
+	}
+	for _, v := range vars {
+		if name, value, ok := strings.Cut(v, "="); ok {
+			e.set(name, value)
+		}
+	}
+	return e
+}
+
+func (e *environment) set(name, value string) {
+	e.vars = append(e.vars, name+"="+value)
+	e.values[name] = value
+}
+
+func (e *environment) lookup(name string) (string, bool) {
+	value, ok := e.values[name]
+	return value, ok
+}
+
+// addService load the env files of a service and its env, relative files are resolved in dir,
+// ${VAR} references are expanded with everything, that was set before
+func (e *environment) addService(service *vo.Service, dir string) error {
+	for _, file := range service.EnvFiles {
+		file = expandEnv(file, e.lookup)
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		f, errOpen := os.Open(file)
+		if errOpen != nil {
+			return fmt.Errorf("could not open env file of service %q: %w", service.ID, errOpen)
+		}
+		vars, errParse := parseEnvFile(f)
+		_ = f.Close()
+		if errParse != nil {
+			return fmt.Errorf("invalid env file %q: %w", file, errParse)
+		}
+		for _, v := range vars {
+			if v.expand {
+				v.value = expandEnv(v.value, e.lookup)
+			}
+			e.set(v.name, v.value)
+		}
+	}
+	names := make([]string, 0, len(service.Env))
+	for name := range service.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		e.set(name, expandEnv(service.Env[name], e.lookup))
+	}
+	return nil
+}
+
+// commandEnv the environment of a command, ports have to be set in env, followed by what
+// webgrapple provides and the env from options, service env files and env come on top
+func commandEnv(o *options, reverseProxyURL string, port int, id vo.ServiceID) *environment {
+	vars := []string{fmt.Sprint("PORT=", port)}
+	vars = append(vars, webgrappleEnv(o, reverseProxyURL, id)...)
+	return newEnvironment(append(vars, o.env...)...)
+}
+
+// envNames the names of NAME=value pairs
+func envNames(env []string) []string {
+	names := make([]string, 0, len(env))
+	for _, pair := range env {
+		name, _, _ := strings.Cut(pair, "=")
+		names = append(names, name)
+	}
+	return names
+}
+
+// webgrappleEnv the env vars webgrapple passes to the command of a service
+func webgrappleEnv(o *options, reverseProxyURL string, id vo.ServiceID) []string {
+	env := []string{
+		EnvPublicURL + "=" + o.publicURL,
+		EnvServiceID + "=" + string(id),
+		EnvServiceURL + "=" + reverseProxyURL,
+	}
+	// do not override the users own CAs
+	if _, ok := os.LookupEnv(envNodeCAs); !ok {
+		if caCertFile := o.caCertFile; caCertFile != "" {
+			env = append(env, envNodeCAs+"="+caCertFile)
+		} else if caDir, _, errCADir := certs.ResolveCADir(""); errCADir == nil {
+			caCertFile := filepath.Join(caDir, certs.CACertFileName)
+			if _, errStat := os.Stat(caCertFile); errStat == nil {
+				env = append(env, envNodeCAs+"="+caCertFile)
+			}
+		}
+	}
+	return env
+}
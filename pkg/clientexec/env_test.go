@@ -0,0 +1,89 @@
+package clientexec
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/foomo/webgrapple/pkg/certs"
+	"github.com/foomo/webgrapple/pkg/vo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	vars, errParse := parseEnvFile(strings.NewReader(`
+# comment
+export API_URL=${WEBGRAPPLE_PUBLIC_URL}/api
+PLAIN = value # comment
+DOUBLE="a\nb"
+SINGLE='${NOT_EXPANDED}'
+`))
+	require.NoError(t, errParse)
+	assert.Equal(t, []envVar{
+		{name: "API_URL", value: "${WEBGRAPPLE_PUBLIC_URL}/api", expand: true},
+		{name: "PLAIN", value: "value", expand: true},
+		{name: "DOUBLE", value: "a\nb", expand: true},
+		{name: "SINGLE", value: "${NOT_EXPANDED}"},
+	}, vars)
+
+	_, errParse = parseEnvFile(strings.NewReader("OK=1\nbroken line\n"))
+	assert.ErrorContains(t, errParse, "line 2")
+}
+
+func TestExpandEnv(t *testing.T) {
+	lookup := func(name string) (string, bool) {
+		return map[string]string{"HOST": "localhost"}[name], name == "HOST"
+	}
+	assert.Equal(t, "https://localhost/ and $HOST", expandEnv("https://${HOST}/${MISSING} and $HOST", lookup))
+}
+
+func TestEnvironmentAddService(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".env.local"), []byte("NEXT_PUBLIC_API_URL=${WEBGRAPPLE_PUBLIC_URL}/api\n"), 0o644))
+	o := newOptions(WithPublicURL("https://shop.test"), WithCACertFile("/tmp/ca.pem"))
+	env := commandEnv(o, "http://127.0.0.1:8888", 3000, "storefront")
+	require.NoError(t, env.addService(&vo.Service{
+		ID:       "storefront",
+		EnvFiles: []string{".env.local"},
+		Env:      map[string]string{"API": "${NEXT_PUBLIC_API_URL}/v1"},
+	}, dir))
+	for _, v := range []string{
+		"PORT=3000",
+		"WEBGRAPPLE_PUBLIC_URL=https://shop.test",
+		"WEBGRAPPLE_SERVICE_ID=storefront",
+		"WEBGRAPPLE_SERVICE_URL=http://127.0.0.1:8888",
+		"NEXT_PUBLIC_API_URL=https://shop.test/api",
+		"API=https://shop.test/api/v1",
+	} {
+		assert.Contains(t, env.vars, v)
+	}
+	if _, ok := os.LookupEnv("NODE_EXTRA_CA_CERTS"); !ok {
+		assert.Contains(t, env.vars, "NODE_EXTRA_CA_CERTS=/tmp/ca.pem")
+	}
+
+	assert.Error(t, env.addService(&vo.Service{ID: "cms", EnvFiles: []string{"missing.env"}}, dir))
+}
+
+func TestWebgrappleEnvCAROOT(t *testing.T) {
+	t.Setenv("NODE_EXTRA_CA_CERTS", "")
+	os.Unsetenv("NODE_EXTRA_CA_CERTS")
+	caRoot := t.TempDir()
+	t.Setenv("CAROOT", caRoot)
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	o := newOptions()
+
+	// no CA anywhere
+	assert.Equal(t, []string{"WEBGRAPPLE_PUBLIC_URL", "WEBGRAPPLE_SERVICE_ID", "WEBGRAPPLE_SERVICE_URL"}, envNames(webgrappleEnv(o, "http://127.0.0.1:8888", "app")))
+
+	for _, file := range []string{certs.CACertFileName, certs.CAKeyFileName} {
+		require.NoError(t, os.WriteFile(filepath.Join(caRoot, file), []byte("mkcert"), 0o600))
+	}
+	assert.Contains(t, webgrappleEnv(o, "http://127.0.0.1:8888", "app"), "NODE_EXTRA_CA_CERTS="+filepath.Join(caRoot, certs.CACertFileName))
+}
+
+func TestEnvNames(t *testing.T) {
+	assert.Equal(t, []string{"PORT", "API_TOKEN", "EMPTY", "BROKEN"}, envNames([]string{"PORT=3000", "API_TOKEN=s3cret=", "EMPTY=", "BROKEN"}))
+}
@@ -0,0 +1,101 @@
+package clientexec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/foomo/webgrapple/pkg/log"
+	"github.com/foomo/webgrapple/pkg/vo"
+)
+
+// inspectorCheckInterval how often to look for a new inspector, it changes with every restart
+const inspectorCheckInterval = time.Second
+
+var inspectorRe = regexp.MustCompile(`Debugger listening on (wss?://\S+)`)
+
+// inspectorFromLine the websocket url of node's "Debugger listening on ws://..." line
+func inspectorFromLine(line string) (string, bool) {
+	m := inspectorRe.FindStringSubmatch(ansiEscapeRe.ReplaceAllString(line, ""))
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// newDebug attach urls for an inspector websocket url
+func newDebug(webSocketURL string) *vo.Debug {
+	scheme, target, _ := strings.Cut(webSocketURL, "://")
+	return &vo.Debug{
+		WebSocketURL: webSocketURL,
+		DevToolsURL:  "devtools://devtools/bundled/js_app.html?experiments=true&v8only=true&" + scheme + "=" + target,
+	}
+}
+
+// listInspectorTargets ask the inspector on port for its targets' websocket urls
+func listInspectorTargets(ctx context.Context, port int) ([]string, error) {
+	req, errReq := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprint("http://127.0.0.1:", port, "/json/list"), nil)
+	if errReq != nil {
+		return nil, errReq
+	}
+	resp, errDo := checkClient.Do(req)
+	if errDo != nil {
+		return nil, errDo
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("inspector answered %s", resp.Status)
+	}
+	targets := []struct {
+		WebSocketDebuggerURL string `json:"webSocketDebuggerUrl"`
+	}{}
+	if errDecode := json.NewDecoder(resp.Body).Decode(&targets); errDecode != nil {
+		return nil, errDecode
+	}
+	urls := []string{}
+	for _, target := range targets {
+		if target.WebSocketDebuggerURL != "" {
+			urls = append(urls, target.WebSocketDebuggerURL)
+		}
+	}
+	return urls, nil
+}
+
+// watchInspector look for the inspector of the command in its output and on the debug port until ctx is done,
+// whenever a new one shows up, the attach urls are printed and passed on to the reverse proxy
+func watchInspector(ctx context.Context, l log.Logger, debugPort int, sniffers []*portSniffer, reg *registration, config vo.ClientConfig) {
+	ticker := time.NewTicker(inspectorCheckInterval)
+	defer ticker.Stop()
+	current := ""
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		webSocketURL := ""
+		for _, sniffer := range sniffers {
+			if announced := sniffer.inspectorURL(); announced != "" {
+				webSocketURL = announced
+			}
+		}
+		if debugPort > 0 {
+			listCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+			if urls, errList := listInspectorTargets(listCtx, debugPort); errList == nil && len(urls) > 0 {
+				webSocketURL = urls[0]
+			}
+			cancel()
+		}
+		if webSocketURL == "" || webSocketURL == current {
+			continue
+		}
+		current = webSocketURL
+		debug := newDebug(webSocketURL)
+		l.Info(fmt.Sprintf("debugger attached to %q, open %s in chrome", debug.WebSocketURL, debug.DevToolsURL))
+		reg.setDebug(ctx, config, debug)
+	}
+}
@@ -0,0 +1,63 @@
+package clientexec
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/foomo/webgrapple/pkg/vo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectorFromLine(t *testing.T) {
+	line := "Debugger listening on ws://127.0.0.1:9229/0f2c936f-b1cd-4ac9-aab3-f63b0f33d55e"
+	webSocketURL, ok := inspectorFromLine(line)
+	require.True(t, ok)
+	assert.Equal(t, "ws://127.0.0.1:9229/0f2c936f-b1cd-4ac9-aab3-f63b0f33d55e", webSocketURL)
+	_, ok = portFromLine(line)
+	assert.False(t, ok, "the inspector is no service")
+	_, ok = inspectorFromLine("For help, see: https://nodejs.org/en/docs/inspector")
+	assert.False(t, ok)
+
+	assert.Equal(t,
+		"devtools://devtools/bundled/js_app.html?experiments=true&v8only=true&ws=127.0.0.1:9229/0f2c",
+		newDebug("ws://127.0.0.1:9229/0f2c").DevToolsURL,
+	)
+}
+
+func TestListInspectorTargets(t *testing.T) {
+	inspector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/json/list", r.URL.Path)
+		_, _ = w.Write([]byte(`[{"type": "node", "webSocketDebuggerUrl": "ws://127.0.0.1:9229/0f2c"}]`))
+	}))
+	defer inspector.Close()
+	urls, errList := listInspectorTargets(context.Background(), inspector.Listener.Addr().(*net.TCPAddr).Port)
+	require.NoError(t, errList)
+	assert.Equal(t, []string{"ws://127.0.0.1:9229/0f2c"}, urls)
+}
+
+func TestRegistrationSetDebug(t *testing.T) {
+	proxy := &fakeProxy{}
+	proxyServer := httptest.NewServer(proxy)
+	defer proxyServer.Close()
+
+	ctx := context.Background()
+	service := &vo.Service{ID: "storefront", Address: "http://127.0.0.1:3000"}
+	reg := newRegistration(testLogger{}, proxyServer.URL)
+	require.NoError(t, reg.register(ctx, service))
+	reg.setDebug(ctx, vo.ClientConfig{service}, newDebug("ws://127.0.0.1:9229/0f2c"))
+
+	require.Len(t, proxy.calls, 2)
+	assert.NotContains(t, proxy.calls[0], "ws://")
+	assert.True(t, strings.HasPrefix(proxy.calls[1], "Upsert "), proxy.calls[1])
+	assert.Contains(t, proxy.calls[1], "ws://127.0.0.1:9229/0f2c")
+	assert.Nil(t, service.Debug, "the config is not touched")
+
+	// registering again keeps the inspector
+	require.NoError(t, reg.register(ctx, service))
+	assert.Contains(t, proxy.calls[2], "devtools://")
+}
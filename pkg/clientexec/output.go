@@ -0,0 +1,70 @@
+package clientexec
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+)
+
+// ansi colors for service prefixes
+var prefixColors = []string{"36", "33", "35", "32", "34", "91", "96", "93"}
+
+// prefixWriter writes complete lines with a prefix, writers sharing a lock do not mix their lines
+type prefixWriter struct {
+	w      io.Writer
+	lock   *sync.Mutex
+	prefix []byte
+	buf    []byte
+}
+
+func newPrefixWriter(w io.Writer, lock *sync.Mutex, prefix string, colorIndex int, color bool) *prefixWriter {
+	if color {
+		prefix = "\x1b[" + prefixColors[colorIndex%len(prefixColors)] + "m" + prefix + "\x1b[0m"
+	}
+	return &prefixWriter{
+		w:      w,
+		lock:   lock,
+		prefix: []byte(prefix + " "),
+	}
+}
+
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	pw.lock.Lock()
+	defer pw.lock.Unlock()
+	pw.buf = append(pw.buf, p...)
+	for {
+		i := bytes.IndexByte(pw.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if _, err := pw.w.Write(append(append([]byte{}, pw.prefix...), pw.buf[:i+1]...)); err != nil {
+			return 0, err
+		}
+		pw.buf = pw.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush write an incomplete last line
+func (pw *prefixWriter) Flush() {
+	pw.lock.Lock()
+	defer pw.lock.Unlock()
+	if len(pw.buf) > 0 {
+		_, _ = pw.w.Write(append(append(append([]byte{}, pw.prefix...), pw.buf...), '\n'))
+		pw.buf = nil
+	}
+}
+
+// colorful tells if w is a terminal and NO_COLOR is not set
+func colorful(w io.Writer) bool {
+	if _, noColor := os.LookupEnv("NO_COLOR"); noColor {
+		return false
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, errStat := f.Stat()
+	return errStat == nil && info.Mode()&os.ModeCharDevice != 0
+}
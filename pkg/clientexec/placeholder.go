@@ -0,0 +1,52 @@
+package clientexec
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+)
+
+// placeholder serves a "restarting" page, while the command is down
+type placeholder struct {
+	server   *http.Server
+	listener net.Listener
+}
+
+func newPlaceholder(name string) (*placeholder, error) {
+	listener, errListen := net.Listen("tcp", "127.0.0.1:0")
+	if errListen != nil {
+		return nil, errListen
+	}
+	page := fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head><meta http-equiv="refresh" content="2"><title>restarting %[1]s</title></head>
+<body><h1>%[1]s is restarting</h1><p>webgrapple will reload this page, once it is back.</p></body>
+</html>
+`, html.EscapeString(name))
+	p := &placeholder{
+		listener: listener,
+		server: &http.Server{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				w.Header().Set("Retry-After", "2")
+				w.Header().Set("Cache-Control", "no-store")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				_, _ = w.Write([]byte(page))
+			}),
+		},
+	}
+	go func() {
+		_ = p.server.Serve(listener)
+	}()
+	return p, nil
+}
+
+func (p *placeholder) address() string {
+	return "http://" + p.listener.Addr().String()
+}
+
+func (p *placeholder) close() {
+	_ = p.server.Shutdown(context.Background())
+}
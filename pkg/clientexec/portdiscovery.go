@@ -0,0 +1,85 @@
+package clientexec
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+var (
+	ansiEscapeRe     = regexp.MustCompile(`\x1b\[[0-9;]*[a-zA-Z]`)
+	listenKeywordRe  = regexp.MustCompile(`(?i)\b(listen(ing)?|running|started|serving|local|ready|available)\b`)
+	listenHostPortRe = regexp.MustCompile(`(?:https?://[^\s/:]+|\blocalhost|\b\d{1,3}(?:\.\d{1,3}){3}|\[[0-9a-fA-F:]*\]|\s|^):(\d{2,5})\b`)
+	listenPortRe     = regexp.MustCompile(`(?i)\bport\s*:?\s*(\d{2,5})\b`)
+)
+
+// portFromLine find the port in well known "listening on" lines of dev servers like
+// "Local: http://localhost:5173/", "Listening on port 3000" or "Running on http://127.0.0.1:5000"
+func portFromLine(line string) (int, bool) {
+	line = ansiEscapeRe.ReplaceAllString(line, "")
+	// the inspector is no service
+	if !listenKeywordRe.MatchString(line) || inspectorRe.MatchString(line) {
+		return 0, false
+	}
+	for _, re := range []*regexp.Regexp{listenHostPortRe, listenPortRe} {
+		if m := re.FindStringSubmatch(line); m != nil {
+			port, errAtoi := strconv.Atoi(m[1])
+			if errAtoi == nil && port > 0 && port < 65536 {
+				return port, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// portSniffer passes output through and remembers the ports, that it announces to listen on,
+// and the last inspector
+type portSniffer struct {
+	w         io.Writer
+	lock      sync.Mutex
+	buf       []byte
+	found     []int
+	inspector string
+}
+
+func newPortSniffer(w io.Writer) *portSniffer {
+	return &portSniffer{w: w}
+}
+
+func (ps *portSniffer) Write(p []byte) (int, error) {
+	ps.lock.Lock()
+	ps.buf = append(ps.buf, p...)
+	for {
+		i := bytes.IndexByte(ps.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := string(ps.buf[:i])
+		if inspector, ok := inspectorFromLine(line); ok {
+			ps.inspector = inspector
+		} else if port, ok := portFromLine(line); ok {
+			ps.found = append(ps.found, port)
+		}
+		ps.buf = ps.buf[i+1:]
+	}
+	// long lines without a newline are no announcements
+	if len(ps.buf) > 4096 {
+		ps.buf = nil
+	}
+	ps.lock.Unlock()
+	return ps.w.Write(p)
+}
+
+func (ps *portSniffer) ports() []int {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	return append([]int{}, ps.found...)
+}
+
+func (ps *portSniffer) inspectorURL() string {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	return ps.inspector
+}
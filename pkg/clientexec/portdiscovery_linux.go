@@ -0,0 +1,122 @@
+package clientexec
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// tcpListen socket state in /proc/net/tcp
+const tcpListen = "0A"
+
+// listeningPorts the tcp ports, that the process tree of pid listens on
+func listeningPorts(pid int) ([]int, error) {
+	inodes := map[string]bool{}
+	for _, p := range processTree(pid) {
+		fds, errFDs := os.ReadDir(filepath.Join("/proc", strconv.Itoa(p), "fd"))
+		if errFDs != nil {
+			continue
+		}
+		for _, fd := range fds {
+			link, errLink := os.Readlink(filepath.Join("/proc", strconv.Itoa(p), "fd", fd.Name()))
+			if errLink == nil && strings.HasPrefix(link, "socket:[") {
+				inodes[strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")] = true
+			}
+		}
+	}
+	seen := map[int]bool{}
+	ports := []int{}
+	for _, name := range []string{"tcp", "tcp6"} {
+		socketPorts, errRead := readListeningSockets(filepath.Join("/proc", strconv.Itoa(pid), "net", name))
+		if errRead != nil {
+			if name == "tcp" {
+				return nil, errRead
+			}
+			continue
+		}
+		for inode, port := range socketPorts {
+			if inodes[inode] && !seen[port] {
+				seen[port] = true
+				ports = append(ports, port)
+			}
+		}
+	}
+	sort.Ints(ports)
+	return ports, nil
+}
+
+// readListeningSockets map socket inodes to local ports of listening sockets in a /proc/net/tcp* file
+func readListeningSockets(file string) (map[string]int, error) {
+	f, errOpen := os.Open(file)
+	if errOpen != nil {
+		return nil, errOpen
+	}
+	defer f.Close()
+	return parseListeningSockets(bufio.NewScanner(f)), nil
+}
+
+func parseListeningSockets(scanner *bufio.Scanner) map[string]int {
+	sockets := map[string]int{}
+	// skip the header
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != tcpListen {
+			continue
+		}
+		i := strings.LastIndexByte(fields[1], ':')
+		if i < 0 {
+			continue
+		}
+		port, errParse := strconv.ParseInt(fields[1][i+1:], 16, 32)
+		if errParse != nil {
+			continue
+		}
+		sockets[fields[9]] = int(port)
+	}
+	return sockets
+}
+
+// processTree pid and all its descendants
+func processTree(pid int) []int {
+	entries, errEntries := os.ReadDir("/proc")
+	if errEntries != nil {
+		return []int{pid}
+	}
+	children := map[int][]int{}
+	for _, entry := range entries {
+		p, errAtoi := strconv.Atoi(entry.Name())
+		if errAtoi != nil {
+			continue
+		}
+		stat, errStat := os.ReadFile(filepath.Join("/proc", entry.Name(), "stat"))
+		if errStat != nil {
+			continue
+		}
+		// the command name in braces may contain spaces
+		i := strings.LastIndexByte(string(stat), ')')
+		if i < 0 {
+			continue
+		}
+		fields := strings.Fields(string(stat[i+1:]))
+		if len(fields) < 2 {
+			continue
+		}
+		ppid, errPPID := strconv.Atoi(fields[1])
+		if errPPID == nil {
+			children[ppid] = append(children[ppid], p)
+		}
+	}
+	tree := []int{}
+	queue := []int{pid}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		tree = append(tree, p)
+		queue = append(queue, children[p]...)
+	}
+	return tree
+}
@@ -0,0 +1,29 @@
+package clientexec
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseListeningSockets(t *testing.T) {
+	table := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:0BB8 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 4242 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:0BB8 0100007F:D431 01 00000000:00000000 00:00000000 00000000  1000        0 4243 1 0000000000000000 20 4 30 10 -1
+`
+	assert.Equal(t, map[string]int{"4242": 3000}, parseListeningSockets(bufio.NewScanner(strings.NewReader(table))))
+}
+
+func TestListeningPorts(t *testing.T) {
+	listener, errListen := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, errListen)
+	defer listener.Close()
+	ports, errPorts := listeningPorts(os.Getpid())
+	require.NoError(t, errPorts)
+	assert.Contains(t, ports, listener.Addr().(*net.TCPAddr).Port)
+}
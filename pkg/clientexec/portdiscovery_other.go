@@ -0,0 +1,10 @@
+//go:build !linux
+
+package clientexec
+
+import "errors"
+
+// listeningPorts is only implemented on linux, elsewhere ports are only found in the commands output
+func listeningPorts(pid int) ([]int, error) {
+	return nil, errors.ErrUnsupported
+}
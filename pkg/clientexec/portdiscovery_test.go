@@ -0,0 +1,40 @@
+package clientexec
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPortFromLine(t *testing.T) {
+	for line, want := range map[string]int{
+		"  ➜  Local:   http://localhost:5173/":           5173,
+		"Listening on port 3000":                         3000,
+		" * Running on http://127.0.0.1:5000":            5000,
+		"ready - started server on 0.0.0.0:3000, url: x": 3000,
+		"Now listening on: http://localhost:5000":        5000,
+		"\x1b[32mserver listening\x1b[0m on :8081":       8081,
+	} {
+		port, ok := portFromLine(line)
+		assert.True(t, ok, line)
+		assert.Equal(t, want, port, line)
+	}
+	for _, line := range []string{
+		"started at 12:30:45",
+		"compiled 3000 modules",
+		"GET /api 200 in 12ms",
+	} {
+		_, ok := portFromLine(line)
+		assert.False(t, ok, line)
+	}
+}
+
+func TestPortSniffer(t *testing.T) {
+	out := &bytes.Buffer{}
+	ps := newPortSniffer(out)
+	_, _ = ps.Write([]byte("compiling\nListening on po"))
+	_, _ = ps.Write([]byte("rt 4000\n"))
+	assert.Equal(t, "compiling\nListening on port 4000\n", out.String())
+	assert.Equal(t, []int{4000}, ps.ports())
+}
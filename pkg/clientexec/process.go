@@ -0,0 +1,270 @@
+package clientexec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/foomo/webgrapple/pkg/log"
+	"github.com/foomo/webgrapple/pkg/vo"
+)
+
+// DefaultGracePeriod how long the command may take to terminate, before it is killed
+const DefaultGracePeriod = 10 * time.Second
+
+// ExitError the command failed, Code is its exit code, use it as the own exit code
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("command exited with code %d: %v", e.Code, e.Err)
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// newExitError wrap the error returned from cmd.Wait
+func newExitError(errWait error) error {
+	var errExit *exec.ExitError
+	if errors.As(errWait, &errExit) {
+		return &ExitError{Code: exitCode(errExit.ProcessState), Err: errWait}
+	}
+	return errWait
+}
+
+// stop terminate the commands process group, it is killed, if it does not exit within the grace period
+func stop(l log.Logger, cmd *exec.Cmd, chanCmdWaitErr <-chan error, gracePeriod time.Duration) {
+	if errTerminate := terminateGroup(cmd); errTerminate != nil {
+		l.Error(fmt.Sprintf("could not terminate child processes: %v", errTerminate))
+	}
+	select {
+	case <-chanCmdWaitErr:
+		// children, that ignored the parent going away
+		if errKill := killGroup(cmd); errKill != nil {
+			l.Error(fmt.Sprintf("could not kill remaining child processes: %v", errKill))
+		}
+	case <-time.After(gracePeriod):
+		l.Info(fmt.Sprintf("command did not terminate within %s, killing it", gracePeriod))
+		if errKill := killGroup(cmd); errKill != nil {
+			l.Error(fmt.Sprintf("could not kill child processes: %v", errKill))
+		}
+		<-chanCmdWaitErr
+	}
+}
+
+// process a supervised command and the services it serves
+type process struct {
+	name    string
+	command string
+	args    []string
+	dir     string
+	env     []string
+	config  vo.ClientConfig
+	stdout  io.Writer
+	stderr  io.Writer
+	// forward signals to the command
+	forward chan os.Signal
+	// port assigned in PORT, if the command listens elsewhere, that is discovered
+	port int
+	pid  atomic.Int64
+	// watch restarts the command, when files change
+	watch *watcher
+}
+
+// discoverAddress find where the command listens, if it ignored the assigned port,
+// ports announced in its output come first, then the listening sockets of its process tree
+func (p *process) discoverAddress(ctx context.Context, service *vo.Service, sniffers []*portSniffer, ignorePorts []int) (string, bool) {
+	if p.port == 0 || service.Address != fmt.Sprint("http://127.0.0.1:", p.port) {
+		return "", false
+	}
+	candidates := []int{}
+	for _, sniffer := range sniffers {
+		candidates = append(candidates, sniffer.ports()...)
+	}
+	if pid := p.pid.Load(); pid > 0 {
+		if ports, errPorts := listeningPorts(int(pid)); errPorts == nil {
+			candidates = append(candidates, ports...)
+		}
+	}
+	for _, port := range candidates {
+		if port == p.port || slices.Contains(ignorePorts, port) {
+			continue
+		}
+		address := fmt.Sprint("http://127.0.0.1:", port)
+		if listening(ctx, &vo.Service{Address: address}) == nil {
+			return address, true
+		}
+	}
+	return "", false
+}
+
+// run the command, until it exits for good or ctx is done, its services are registered, when they are ready
+func (p *process) run(ctx context.Context, l log.Logger, o *options, reg *registration) error {
+	chanChanged := make(chan []string)
+	if p.watch != nil {
+		watchCtx, cancelWatch := context.WithCancel(ctx)
+		defer cancelWatch()
+		go p.watch.watch(watchCtx, chanChanged)
+	}
+
+	placeholderAddress := ""
+	// reloads after changes always show the page
+	if (o.supervisor.RestartingPage && o.supervisor.Policy != RestartNever) || p.watch != nil {
+		ph, errPlaceholder := newPlaceholder(p.name)
+		if errPlaceholder != nil {
+			return fmt.Errorf("could not start the restarting page: %w", errPlaceholder)
+		}
+		defer ph.close()
+		placeholderAddress = ph.address()
+	}
+
+	// services are only registered, once they are listening
+	readyCtx, cancelReady := context.WithCancel(ctx)
+	defer cancelReady()
+	chanReadyErr := make(chan error, 1)
+
+	stdoutSniffer := newPortSniffer(p.stdout)
+	stderrSniffer := newPortSniffer(p.stderr)
+	discover := func(ctx context.Context, service *vo.Service) (string, bool) {
+		return p.discoverAddress(ctx, service, []*portSniffer{stdoutSniffer, stderrSniffer}, o.ignorePorts)
+	}
+
+	sup := newSupervisor(o.supervisor)
+	for run := 0; ; run++ {
+		cmd := exec.Command(p.command, p.args...)
+		cmd.Dir = p.dir
+		cmd.Env = append(os.Environ(), p.env...)
+		cmd.Stdout = stdoutSniffer
+		cmd.Stderr = stderrSniffer
+		setProcessGroup(cmd)
+
+		// values may be secrets from env files
+		l.Info(fmt.Sprintf("starting command '%s %s' with env: %s", p.command, strings.Join(p.args, " "), strings.Join(envNames(p.env), " ")))
+		started := time.Now()
+		if errStart := cmd.Start(); errStart != nil {
+			return fmt.Errorf("failed to start: %s, with args %q: %w", p.command, p.args, errStart)
+		}
+		p.pid.Store(int64(cmd.Process.Pid))
+		if run == 0 {
+			go func() {
+				chanReadyErr <- reg.readyAndRegister(readyCtx, p.config, o.readyTimeout, discover)
+			}()
+			go watchInspector(readyCtx, l, o.debugPort, []*portSniffer{stdoutSniffer, stderrSniffer}, reg, p.config)
+		}
+
+		chanCmdWaitErr := make(chan error, 1)
+		go func() {
+			chanCmdWaitErr <- cmd.Wait()
+		}()
+
+		var errWait error
+		reload := false
+	wait:
+		for {
+			select {
+			case errWait = <-chanCmdWaitErr:
+				// whatever the command left behind would block the port
+				if errKill := killGroup(cmd); errKill != nil {
+					l.Error(fmt.Sprintf("could not kill remaining child processes: %v", errKill))
+				}
+				break wait
+			case sig := <-p.forward:
+				l.Info(fmt.Sprintf("forwarding signal (%s) to the command", sig.String()))
+				if errSignal := forwardSignal(cmd, sig); errSignal != nil {
+					l.Error(fmt.Sprintf("could not forward signal: %v", errSignal))
+				}
+			case changed := <-chanChanged:
+				l.Info(fmt.Sprintf("%d files changed (%s), restarting the command", len(changed), summarizeFiles(changed)))
+				reg.hold(ctx, p.config, placeholderAddress)
+				stop(l, cmd, chanCmdWaitErr, o.gracePeriod)
+				reload = true
+				break wait
+			case errReady := <-chanReadyErr:
+				stop(l, cmd, chanCmdWaitErr, o.gracePeriod)
+				return errReady
+			case <-ctx.Done():
+				stop(l, cmd, chanCmdWaitErr, o.gracePeriod)
+				return nil
+			}
+		}
+		if reload {
+			// not a crash, the supervisor does not count it
+			continue
+		}
+
+		delay, restart, errGiveUp := sup.next(errWait, time.Since(started), time.Now())
+		if errGiveUp != nil {
+			return fmt.Errorf("%w, last exit: %w", errGiveUp, newExitError(errWait))
+		}
+		if !restart {
+			if errWait != nil {
+				return fmt.Errorf("command execution failed: %w", newExitError(errWait))
+			}
+			l.Info("command complete")
+			return nil
+		}
+		l.Info(fmt.Sprintf("command exited (%v), restart %d in %s", errWait, sup.restarts, delay))
+		reg.hold(ctx, p.config, placeholderAddress)
+		select {
+		case <-time.After(delay):
+		case errReady := <-chanReadyErr:
+			return errReady
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// summarizeFiles the first few of many files
+func summarizeFiles(files []string) string {
+	const maxFiles = 3
+	if len(files) > maxFiles {
+		return strings.Join(files[:maxFiles], ", ") + ", ..."
+	}
+	return strings.Join(files, ", ")
+}
+
+// handleSignals cancel on shutdown signals and forward the others to the processes, call the returned func to stop
+func handleSignals(l log.Logger, cancel context.CancelFunc, processes ...*process) func() {
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, shutdownSignals...)
+	forwardChan := make(chan os.Signal, 1)
+	if len(forwardedSignals) > 0 {
+		signal.Notify(forwardChan, forwardedSignals...)
+	}
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-signalChan:
+				l.Info(fmt.Sprintf("received signal (%s), shutting down gracefully", sig.String()))
+				cancel()
+			case sig := <-forwardChan:
+				for _, p := range processes {
+					select {
+					case p.forward <- sig:
+					default:
+					}
+				}
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(signalChan)
+		signal.Stop(forwardChan)
+		close(done)
+	}
+}
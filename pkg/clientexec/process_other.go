@@ -0,0 +1,39 @@
+//go:build !unix
+
+package clientexec
+
+import (
+	"os"
+	"os/exec"
+)
+
+var (
+	shutdownSignals  = []os.Signal{os.Interrupt}
+	forwardedSignals = []os.Signal{}
+)
+
+// there are no process groups, only the command itself is stopped
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// there is no SIGTERM, the command is killed right away
+func terminateGroup(cmd *exec.Cmd) error {
+	return killGroup(cmd)
+}
+
+func killGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	if err := cmd.Process.Kill(); err != nil && err != os.ErrProcessDone {
+		return err
+	}
+	return nil
+}
+
+func forwardSignal(cmd *exec.Cmd, sig os.Signal) error {
+	return cmd.Process.Signal(sig)
+}
+
+func exitCode(state *os.ProcessState) int {
+	return state.ExitCode()
+}
@@ -0,0 +1,88 @@
+//go:build unix
+
+package clientexec
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunExitCode(t *testing.T) {
+	proxyServer := httptest.NewServer(&fakeProxy{})
+	defer proxyServer.Close()
+	workDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(workDir, "webgrapple.yaml"), []byte("- {}\n"), 0o644))
+
+	errRun := Run(context.Background(), testLogger{}, proxyServer.URL, workDir, "sh", []string{"-c", "exit 3"})
+	var errExit *ExitError
+	require.True(t, errors.As(errRun, &errExit), errRun)
+	assert.Equal(t, 3, errExit.Code)
+}
+
+func TestRunStopsProcessGroup(t *testing.T) {
+	proxyServer := httptest.NewServer(&fakeProxy{})
+	defer proxyServer.Close()
+	workDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(workDir, "webgrapple.yaml"), []byte("- {}\n"), 0o644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		// wait for the grand child to be started
+		for range 100 {
+			if _, errStat := os.Stat(filepath.Join(workDir, "pid")); errStat == nil {
+				break
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		cancel()
+	}()
+	errRun := Run(
+		ctx, testLogger{}, proxyServer.URL, workDir,
+		"sh", []string{"-c", "trap '' TERM; sleep 30 & echo $! > pid; wait"},
+		WithGracePeriod(200*time.Millisecond),
+	)
+	require.NoError(t, errRun)
+
+	pidBytes, errRead := os.ReadFile(filepath.Join(workDir, "pid"))
+	require.NoError(t, errRead)
+	pid, errAtoi := strconv.Atoi(strings.TrimSpace(string(pidBytes)))
+	require.NoError(t, errAtoi)
+	assert.Eventually(t, func() bool {
+		return errors.Is(syscall.Kill(pid, 0), syscall.ESRCH)
+	}, 2*time.Second, 20*time.Millisecond, "grand child %d is still running", pid)
+}
+
+func TestForwardSignalReachesProcessGroup(t *testing.T) {
+	dir := t.TempDir()
+	// the grand child reloads on SIGHUP, the direct child would just die
+	cmd := exec.Command("sh", "-c", "sh -c 'trap \"echo reloaded > reloaded\" HUP; touch ready; while :; do sleep 0.05; done' & wait")
+	cmd.Dir = dir
+	setProcessGroup(cmd)
+	require.NoError(t, cmd.Start())
+	defer func() {
+		_ = killGroup(cmd)
+		_ = cmd.Wait()
+	}()
+	require.Eventually(t, func() bool {
+		_, errStat := os.Stat(filepath.Join(dir, "ready"))
+		return errStat == nil
+	}, 2*time.Second, 20*time.Millisecond)
+
+	require.NoError(t, forwardSignal(cmd, syscall.SIGHUP))
+	assert.Eventually(t, func() bool {
+		_, errStat := os.Stat(filepath.Join(dir, "reloaded"))
+		return errStat == nil
+	}, 2*time.Second, 20*time.Millisecond, "grand child did not get the signal")
+}
@@ -0,0 +1,60 @@
+//go:build unix
+
+package clientexec
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+var (
+	// shutdownSignals stop the command gracefully
+	shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	// forwardedSignals are passed on to the command, e.g. to reload its config
+	forwardedSignals = []os.Signal{syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2}
+)
+
+// setProcessGroup start the command in its own process group, so that its children can be stopped with it
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// terminateGroup ask the whole process group to terminate
+func terminateGroup(cmd *exec.Cmd) error {
+	return signalGroup(cmd, syscall.SIGTERM)
+}
+
+// killGroup kill the whole process group
+func killGroup(cmd *exec.Cmd) error {
+	return signalGroup(cmd, syscall.SIGKILL)
+}
+
+// forwardSignal pass a signal on to the whole process group, like a terminal would
+func forwardSignal(cmd *exec.Cmd, sig os.Signal) error {
+	if s, ok := sig.(syscall.Signal); ok {
+		return signalGroup(cmd, s)
+	}
+	return cmd.Process.Signal(sig)
+}
+
+func signalGroup(cmd *exec.Cmd, sig syscall.Signal) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	err := syscall.Kill(-cmd.Process.Pid, sig)
+	if errors.Is(err, syscall.ESRCH) {
+		// the group is gone already
+		return nil
+	}
+	return err
+}
+
+// exitCode like a shell reports it, 128 + signal for commands, that were killed by a signal
+func exitCode(state *os.ProcessState) int {
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return state.ExitCode()
+}
@@ -0,0 +1,409 @@
+package clientexec
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/foomo/webgrapple/pkg/log"
+	"github.com/foomo/webgrapple/pkg/server"
+	"github.com/foomo/webgrapple/pkg/vo"
+)
+
+const (
+	// DefaultReadyTimeout how long to wait for a service to listen after starting the command
+	DefaultReadyTimeout = 2 * time.Minute
+
+	readyCheckInterval    = 250 * time.Millisecond
+	readyProgressInterval = 5 * time.Second
+	livenessCheckInterval = 2 * time.Second
+	proxyCheckInterval    = 2 * time.Second
+	checkTimeout          = 2 * time.Second
+	// discoveryDelay give a command time to bind the assigned port, before looking elsewhere
+	discoveryDelay = 2 * time.Second
+)
+
+var checkClient = &http.Client{
+	Timeout: checkTimeout,
+	// a redirect is an answer
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// listening tells if a service accepts tcp connections, or answers its health path without a server error
+func listening(ctx context.Context, service *vo.Service) error {
+	serviceURL, errParse := url.Parse(service.Address)
+	if errParse != nil {
+		return errParse
+	}
+	if service.HealthPath == "" {
+		host := serviceURL.Host
+		if serviceURL.Port() == "" {
+			port := "80"
+			if serviceURL.Scheme == "https" {
+				port = "443"
+			}
+			host = net.JoinHostPort(serviceURL.Hostname(), port)
+		}
+		conn, errDial := (&net.Dialer{Timeout: checkTimeout}).DialContext(ctx, "tcp", host)
+		if errDial != nil {
+			return errDial
+		}
+		return conn.Close()
+	}
+	healthURL := strings.TrimSuffix(service.Address, "/") + "/" + strings.TrimPrefix(service.HealthPath, "/")
+	req, errReq := http.NewRequestWithContext(ctx, http.MethodGet, healthURL, nil)
+	if errReq != nil {
+		return errReq
+	}
+	resp, errDo := checkClient.Do(req)
+	if errDo != nil {
+		return errDo
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("health check %q answered %s", healthURL, resp.Status)
+	}
+	return nil
+}
+
+// discoverFunc finds the address a service really listens on
+type discoverFunc func(ctx context.Context, service *vo.Service) (address string, ok bool)
+
+// registration keeps track of the services, that are registered with the reverse proxy
+type registration struct {
+	l      log.Logger
+	client *server.HTTPServiceGoTSRPCClient
+	lock   sync.Mutex
+	// registered what the proxy knows about a service
+	registered map[vo.ServiceID]*vo.Service
+	// holding services while their command restarts, they stay registered, even if they do not listen
+	holding map[vo.ServiceID]bool
+	// debug inspectors of services
+	debug map[vo.ServiceID]*vo.Debug
+}
+
+func newRegistration(l log.Logger, reverseProxyURL string) *registration {
+	return &registration{
+		l:          l,
+		client:     server.NewServiceGoTSRPCClient(reverseProxyURL, server.DefaultEndPoint),
+		registered: map[vo.ServiceID]*vo.Service{},
+		holding:    map[vo.ServiceID]bool{},
+		debug:      map[vo.ServiceID]*vo.Debug{},
+	}
+}
+
+func (r *registration) isRegistered(id vo.ServiceID) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.registered[id] != nil
+}
+
+func (r *registration) isHolding(config vo.ClientConfig) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, service := range config {
+		if r.holding[service.ID] {
+			return true
+		}
+	}
+	return false
+}
+
+// hold keep the services registered while the command restarts, if placeholderAddress is given,
+// the proxy is pointed to it in the meantime
+func (r *registration) hold(ctx context.Context, config vo.ClientConfig, placeholderAddress string) {
+	r.lock.Lock()
+	for _, service := range config {
+		r.holding[service.ID] = true
+	}
+	r.lock.Unlock()
+	if placeholderAddress == "" {
+		return
+	}
+	placeholders := vo.ClientConfig{}
+	r.lock.Lock()
+	for _, service := range config {
+		if registered := r.registered[service.ID]; registered != nil {
+			placeholderService := *registered
+			placeholderService.Address = placeholderAddress
+			placeholders = append(placeholders, &placeholderService)
+			r.registered[service.ID] = &placeholderService
+		}
+	}
+	r.lock.Unlock()
+	if len(placeholders) == 0 {
+		return
+	}
+	errUpsert, errClient := r.client.Upsert(ctx, placeholders)
+	if errClient != nil {
+		r.l.Error(fmt.Sprintf("could not point services to the restarting page, got a client error: %v", errClient))
+	}
+	if errUpsert != nil {
+		r.l.Error(fmt.Sprintf("could not point services to the restarting page due to error: %v", errUpsert))
+	}
+}
+
+// proxyService a copy of service without what only the client needs to run it, env values may be secrets
+func proxyService(service *vo.Service) *vo.Service {
+	registeredService := *service
+	registeredService.Command = nil
+	registeredService.Dir = ""
+	registeredService.EnvFiles = nil
+	registeredService.Env = nil
+	registeredService.Watch = nil
+	return &registeredService
+}
+
+func (r *registration) register(ctx context.Context, service *vo.Service) error {
+	// the proxy gets a copy with the current inspector
+	service = proxyService(service)
+	r.lock.Lock()
+	service.Debug = r.debug[service.ID]
+	r.lock.Unlock()
+	errUpsert, errClient := r.client.Upsert(ctx, vo.ClientConfig{service})
+	if errClient != nil {
+		return errClient
+	}
+	if errUpsert != nil {
+		return errUpsert
+	}
+	r.lock.Lock()
+	r.registered[service.ID] = service
+	r.lock.Unlock()
+	r.l.Info(fmt.Sprintf("registered service %q with the reverse proxy", service.ID))
+	return nil
+}
+
+// setDebug tell the proxy about the inspector of the services
+func (r *registration) setDebug(ctx context.Context, config vo.ClientConfig, debug *vo.Debug) {
+	updates := vo.ClientConfig{}
+	r.lock.Lock()
+	for _, service := range config {
+		r.debug[service.ID] = debug
+		if registered := r.registered[service.ID]; registered != nil {
+			update := *registered
+			update.Debug = debug
+			r.registered[service.ID] = &update
+			updates = append(updates, &update)
+		}
+	}
+	r.lock.Unlock()
+	if len(updates) == 0 {
+		return
+	}
+	errUpsert, errClient := r.client.Upsert(ctx, updates)
+	if errClient != nil {
+		r.l.Error(fmt.Sprintf("could not update the debugger of services, got a client error: %v", errClient))
+	}
+	if errUpsert != nil {
+		r.l.Error(fmt.Sprintf("could not update the debugger of services due to error: %v", errUpsert))
+	}
+}
+
+func (r *registration) deregister(ctx context.Context, ids ...vo.ServiceID) {
+	r.lock.Lock()
+	registeredIDs := []vo.ServiceID{}
+	for _, id := range ids {
+		if r.registered[id] != nil {
+			registeredIDs = append(registeredIDs, id)
+			delete(r.registered, id)
+		}
+	}
+	r.lock.Unlock()
+	if len(registeredIDs) == 0 {
+		return
+	}
+	errRemove, errClient := r.client.Remove(ctx, registeredIDs)
+	if errClient != nil {
+		r.l.Error(fmt.Sprintf("could not remove services, got a client error: %v", errClient))
+	}
+	if errRemove != nil {
+		r.l.Error(fmt.Sprintf("could not remove services due to error: %v", errRemove))
+	}
+}
+
+func (r *registration) deregisterAll(ctx context.Context) {
+	r.lock.Lock()
+	ids := []vo.ServiceID{}
+	for id := range r.registered {
+		ids = append(ids, id)
+	}
+	r.lock.Unlock()
+	r.deregister(ctx, ids...)
+}
+
+// waitReady poll a service until it is listening, the timeout is over or ctx is done, if it does not listen
+// on its address for a while, discover is asked, if the service can be found elsewhere
+func (r *registration) waitReady(ctx context.Context, service *vo.Service, timeout time.Duration, discover discoverFunc) error {
+	start := time.Now()
+	deadline := start.Add(timeout)
+	lastProgress := start
+	for {
+		errListening := listening(ctx, service)
+		if errListening == nil {
+			r.l.Info(fmt.Sprintf("service %q is ready at %q after %s", service.ID, service.Address, time.Since(start).Round(time.Millisecond)))
+			return nil
+		}
+		now := time.Now()
+		if discover != nil && now.Sub(start) >= discoveryDelay {
+			if address, ok := discover(ctx, service); ok {
+				r.l.Error(fmt.Sprintf("service %q listens on %q instead of the assigned %q, did it ignore PORT?", service.ID, address, service.Address))
+				// hold and register copy the service under the lock
+				r.lock.Lock()
+				service.Address = address
+				r.lock.Unlock()
+				continue
+			}
+		}
+		if now.After(deadline) {
+			return fmt.Errorf("service %q did not get ready at %q within %s: %w", service.ID, service.Address, timeout, errListening)
+		}
+		if now.Sub(lastProgress) >= readyProgressInterval {
+			lastProgress = now
+			r.l.Info(fmt.Sprintf("still waiting for service %q at %q (%s): %v", service.ID, service.Address, now.Sub(start).Round(time.Second), errListening))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(readyCheckInterval):
+		}
+	}
+}
+
+// readyAndRegister wait for every service to get ready and register it, the services are deregistered,
+// while they stop listening and registered again, when they come back, until ctx is done
+func (r *registration) readyAndRegister(ctx context.Context, config vo.ClientConfig, timeout time.Duration, discover discoverFunc) error {
+	for _, service := range config {
+		r.l.Info(fmt.Sprintf("waiting for service %q to get ready at %q", service.ID, service.Address))
+		if errReady := r.waitReady(ctx, service, timeout, discover); errReady != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return errReady
+		}
+		if errRegister := r.register(ctx, service); errRegister != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("could not register service %q, is the proxy running?: %w", service.ID, errRegister)
+		}
+	}
+	ticker := time.NewTicker(livenessCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		if r.isHolding(config) {
+			r.release(ctx, config)
+			continue
+		}
+		for _, service := range config {
+			errListening := listening(ctx, service)
+			if ctx.Err() != nil {
+				return nil
+			}
+			switch registered := r.isRegistered(service.ID); {
+			case errListening != nil && registered:
+				r.l.Info(fmt.Sprintf("service %q stopped listening, deregistering it: %v", service.ID, errListening))
+				r.deregister(ctx, service.ID)
+			case errListening == nil && !registered:
+				r.l.Info(fmt.Sprintf("service %q is listening again", service.ID))
+				if errRegister := r.register(ctx, service); errRegister != nil {
+					r.l.Error(fmt.Sprintf("could not register service %q again: %v", service.ID, errRegister))
+				}
+			}
+		}
+	}
+}
+
+// release stop holding, once all services are listening again after a restart
+func (r *registration) release(ctx context.Context, config vo.ClientConfig) {
+	for _, service := range config {
+		if listening(ctx, service) != nil {
+			return
+		}
+	}
+	for _, service := range config {
+		if errRegister := r.register(ctx, service); errRegister != nil {
+			r.l.Error(fmt.Sprintf("could not register service %q after the restart: %v", service.ID, errRegister))
+			return
+		}
+	}
+	r.lock.Lock()
+	for _, service := range config {
+		delete(r.holding, service.ID)
+	}
+	r.lock.Unlock()
+	r.l.Info("all services are back after the restart")
+}
+
+// watchProxy check the reverse proxy until ctx is done, when it was restarted, it has forgotten about
+// our services and they are registered again
+func (r *registration) watchProxy(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	instanceID := ""
+	var downSince time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		statusCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+		currentInstanceID, errStatus, errClient := r.client.Status(statusCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if errClient == nil && errStatus != nil {
+			errClient = errStatus
+		}
+		if errClient != nil {
+			if downSince.IsZero() {
+				downSince = time.Now()
+				r.l.Error(fmt.Sprintf("reverse proxy is unavailable, will register again, once it is back: %v", errClient))
+			}
+			continue
+		}
+		if !downSince.IsZero() {
+			r.l.Info(fmt.Sprintf("reverse proxy was unavailable for %s from %s to %s", time.Since(downSince).Round(time.Second), downSince.Format(time.TimeOnly), time.Now().Format(time.TimeOnly)))
+			downSince = time.Time{}
+		}
+		if instanceID != "" && currentInstanceID != instanceID {
+			r.l.Info("reverse proxy was restarted, registering services again")
+			r.reregister(ctx)
+		}
+		instanceID = currentInstanceID
+	}
+}
+
+// reregister tell the proxy again about everything, that is registered
+func (r *registration) reregister(ctx context.Context) {
+	r.lock.Lock()
+	services := vo.ClientConfig{}
+	for _, service := range r.registered {
+		services = append(services, service)
+	}
+	r.lock.Unlock()
+	if len(services) == 0 {
+		return
+	}
+	errUpsert, errClient := r.client.Upsert(ctx, services)
+	if errClient != nil {
+		r.l.Error(fmt.Sprintf("could not register services again, got a client error: %v", errClient))
+	}
+	if errUpsert != nil {
+		r.l.Error(fmt.Sprintf("could not register services again due to error: %v", errUpsert))
+	}
+}
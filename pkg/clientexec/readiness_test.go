@@ -0,0 +1,152 @@
+package clientexec
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/foomo/webgrapple/pkg/server"
+	"github.com/foomo/webgrapple/pkg/vo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// restartingProxy answers Status with an instance id, that can be changed to simulate a restart
+type restartingProxy struct {
+	lock       sync.Mutex
+	instanceID string
+	down       bool
+	upserts    int
+}
+
+func (p *restartingProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.down {
+		http.Error(w, "down", http.StatusBadGateway)
+		return
+	}
+	switch strings.TrimPrefix(r.URL.Path, server.DefaultEndPoint+"/") {
+	case "Status":
+		_, _ = w.Write([]byte(`["` + p.instanceID + `",null]`))
+	case "Upsert":
+		p.upserts++
+		_, _ = w.Write([]byte("[null]"))
+	default:
+		_, _ = w.Write([]byte("[null]"))
+	}
+}
+
+func (p *restartingProxy) set(f func(p *restartingProxy)) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	f(p)
+}
+
+func (p *restartingProxy) upsertCount() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.upserts
+}
+
+func TestWatchProxyRegistersAgainAfterRestart(t *testing.T) {
+	proxy := &restartingProxy{instanceID: "first"}
+	proxyServer := httptest.NewServer(proxy)
+	defer proxyServer.Close()
+
+	reg := newRegistration(testLogger{}, proxyServer.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, reg.register(ctx, &vo.Service{ID: "app", Address: "http://127.0.0.1:1"}))
+	go reg.watchProxy(ctx, 10*time.Millisecond)
+
+	// nothing changes, while the same instance is running
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 1, proxy.upsertCount())
+
+	proxy.set(func(p *restartingProxy) { p.down = true })
+	time.Sleep(50 * time.Millisecond)
+	proxy.set(func(p *restartingProxy) {
+		p.down = false
+		p.instanceID = "second"
+	})
+	assert.Eventually(t, func() bool {
+		return proxy.upsertCount() == 2
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestReadyAndRegisterDiscoveredAddressWhileHolding(t *testing.T) {
+	proxyServer := httptest.NewServer(&fakeProxy{})
+	defer proxyServer.Close()
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer service.Close()
+
+	reg := newRegistration(testLogger{}, proxyServer.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// registered before the restart, nobody listens on the assigned port anymore
+	config := vo.ClientConfig{{ID: "app", Address: "http://127.0.0.1:1"}}
+	require.NoError(t, reg.register(ctx, config[0]))
+
+	holdCtx, stopHolding := context.WithCancel(ctx)
+	holding := make(chan struct{})
+	go func() {
+		defer close(holding)
+		for holdCtx.Err() == nil {
+			reg.hold(holdCtx, config, "http://127.0.0.1:2")
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	discover := func(ctx context.Context, s *vo.Service) (string, bool) {
+		return service.URL, true
+	}
+	readyCtx, cancelReady := context.WithTimeout(ctx, discoveryDelay+2*time.Second)
+	defer cancelReady()
+	require.NoError(t, reg.waitReady(readyCtx, config[0], time.Minute, discover))
+	stopHolding()
+	<-holding
+
+	reg.lock.Lock()
+	defer reg.lock.Unlock()
+	assert.Equal(t, service.URL, config[0].Address)
+}
+
+func TestRegistrationKeepsClientFieldsFromTheProxy(t *testing.T) {
+	proxy := &fakeProxy{}
+	proxyServer := httptest.NewServer(proxy)
+	defer proxyServer.Close()
+
+	reg := newRegistration(testLogger{}, proxyServer.URL)
+	ctx := t.Context()
+	config := vo.ClientConfig{{
+		ID:       "app",
+		Address:  "http://127.0.0.1:1",
+		Routes:   []string{"/app"},
+		Command:  []string{"yarn", "dev"},
+		Dir:      "apps/app",
+		EnvFiles: []string{".env.local"},
+		Env:      map[string]string{"API_TOKEN": "s3cret"},
+		Watch:    []string{"src/**"},
+	}}
+	require.NoError(t, reg.register(ctx, config[0]))
+	reg.hold(ctx, config, "http://127.0.0.1:2")
+	reg.setDebug(ctx, config, &vo.Debug{WebSocketURL: "ws://127.0.0.1:9229/app"})
+	reg.reregister(ctx)
+
+	proxy.lock.Lock()
+	defer proxy.lock.Unlock()
+	require.Len(t, proxy.calls, 4)
+	for _, call := range proxy.calls {
+		assert.Contains(t, call, "/app")
+		for _, clientOnly := range []string{"s3cret", "yarn", "apps/app", ".env.local", "src/**"} {
+			assert.NotContains(t, call, clientOnly)
+		}
+	}
+	// the config keeps everything to run the command
+	assert.Equal(t, map[string]string{"API_TOKEN": "s3cret"}, config[0].Env)
+	assert.Equal(t, []string{"yarn", "dev"}, config[0].Command)
+}
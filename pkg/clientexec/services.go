@@ -0,0 +1,164 @@
+package clientexec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/foomo/webgrapple/pkg/log"
+	"github.com/foomo/webgrapple/pkg/vo"
+	"golang.org/x/sync/errgroup"
+)
+
+// serviceLogger prefixes log messages with the service id
+type serviceLogger struct {
+	l  log.Logger
+	id vo.ServiceID
+}
+
+func (sl serviceLogger) Info(a ...interface{}) {
+	sl.l.Info(append([]interface{}{string(sl.id) + ": "}, a...)...)
+}
+
+func (sl serviceLogger) Error(a ...interface{}) {
+	sl.l.Error(append([]interface{}{string(sl.id) + ": "}, a...)...)
+}
+
+// RunServices start the command of every service in webgrapple.yaml, each one gets its own free port in PORT
+// and its output is prefixed with the service id, services are registered, when they are ready, when one of
+// the commands is done for good, all of them are stopped together, remote services are only registered
+func RunServices(
+	ctx context.Context,
+	l log.Logger,
+	reverseProxyURL string,
+	workDir string,
+	opts ...Option,
+) error {
+	o := newOptions(opts...)
+	configPath := o.configPath
+	if configPath == "" {
+		configPath = filepath.Join(workDir, "webgrapple.yaml")
+	}
+	config, errGetConfig := GetConfig(l, workDir, configPath)
+	if errGetConfig != nil {
+		return fmt.Errorf("failed to get config webgrapple.yaml is missing ?!: %w", errGetConfig)
+	}
+	configDir, errAbs := filepath.Abs(filepath.Dir(configPath))
+	if errAbs != nil {
+		return errAbs
+	}
+
+	width := 0
+	seen := map[vo.ServiceID]bool{}
+	for _, service := range config {
+		switch {
+		case service.ID == "":
+			return errors.New("every service needs an id, when running all services")
+		case service.Type == vo.ServiceTypeRemote:
+		case len(service.Command) == 0:
+			return fmt.Errorf("service %q has no command", service.ID)
+		case seen[service.ID]:
+			return fmt.Errorf("service id %q is used more than once", service.ID)
+		}
+		seen[service.ID] = true
+		width = max(width, len(service.ID))
+	}
+
+	color := colorful(o.stdout)
+	outputLock := &sync.Mutex{}
+	processes := []*process{}
+	remote := vo.ClientConfig{}
+	for i, service := range config {
+		if service.Type == vo.ServiceTypeRemote {
+			remote = append(remote, service)
+			continue
+		}
+		port, errPort := servicePort(service)
+		if errPort != nil {
+			return errPort
+		}
+		if service.Address == "" {
+			service.Address = fmt.Sprint("http://127.0.0.1:", port)
+		}
+		if service.HealthPath == "" {
+			service.HealthPath = o.healthPath
+		}
+		dir := configDir
+		if service.Dir != "" {
+			dir = service.Dir
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(configDir, dir)
+			}
+		}
+		env := commandEnv(o, reverseProxyURL, port, service.ID)
+		if errEnv := env.addService(service, configDir); errEnv != nil {
+			return errEnv
+		}
+		prefix := fmt.Sprintf("%-*s |", width, service.ID)
+		processes = append(processes, &process{
+			name:    string(service.ID),
+			command: service.Command[0],
+			args:    service.Command[1:],
+			dir:     dir,
+			env:     env.vars,
+			config:  vo.ClientConfig{service},
+			stdout:  newPrefixWriter(o.stdout, outputLock, prefix, i, color),
+			stderr:  newPrefixWriter(o.stderr, outputLock, prefix, i, color),
+			forward: make(chan os.Signal, 1),
+			port:    port,
+			watch:   newWatcher(dir, service.Watch),
+		})
+	}
+
+	reg := newRegistration(l, reverseProxyURL)
+	defer reg.deregisterAll(context.WithoutCancel(ctx))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer handleSignals(l, cancel, processes...)()
+	go reg.watchProxy(ctx, proxyCheckInterval)
+
+	defer l.Info("terminating")
+	g := &errgroup.Group{}
+	for _, p := range processes {
+		g.Go(func() error {
+			defer p.stdout.(*prefixWriter).Flush()
+			defer p.stderr.(*prefixWriter).Flush()
+			// one is done, all are done
+			defer cancel()
+			errRun := p.run(ctx, serviceLogger{l: l, id: vo.ServiceID(p.name)}, o, reg)
+			if errRun != nil {
+				return fmt.Errorf("service %q: %w", p.name, errRun)
+			}
+			return nil
+		})
+	}
+	if len(remote) > 0 {
+		// already running somewhere, they are only registered
+		g.Go(func() error {
+			defer cancel()
+			return reg.readyAndRegister(ctx, remote, o.readyTimeout, nil)
+		})
+	}
+	return g.Wait()
+}
+
+// servicePort the port of a configured address or a free one
+func servicePort(service *vo.Service) (int, error) {
+	if service.Address == "" {
+		return FreePort()
+	}
+	serviceURL, errParse := url.Parse(service.Address)
+	if errParse != nil {
+		return 0, fmt.Errorf("invalid address of service %q: %w", service.ID, errParse)
+	}
+	if serviceURL.Port() == "" {
+		return 0, fmt.Errorf("address of service %q has no port", service.ID)
+	}
+	return strconv.Atoi(serviceURL.Port())
+}
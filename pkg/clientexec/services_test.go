@@ -0,0 +1,70 @@
+package clientexec
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunServices(t *testing.T) {
+	proxyServer := httptest.NewServer(&fakeProxy{})
+	defer proxyServer.Close()
+
+	workDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(workDir, "cms"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(workDir, "webgrapple.yaml"), []byte(`
+- id: storefront
+  command: [sh, -c, "echo storefront $GREETING; sleep 0.5"]
+  env:
+    GREETING: hello
+- id: cms
+  dir: cms
+  command: [sh, -c, "pwd; sleep 10"]
+`), 0o644))
+
+	stdout := &bytes.Buffer{}
+	errRun := RunServices(context.Background(), testLogger{}, proxyServer.URL, workDir, WithOutput(stdout, io.Discard))
+	require.NoError(t, errRun)
+	output := stdout.String()
+	assert.Contains(t, output, "storefront | storefront hello\n")
+	assert.Contains(t, output, "cms        | "+filepath.Join(workDir, "cms")+"\n")
+}
+
+func TestRunServicesNeedCommands(t *testing.T) {
+	workDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(workDir, "webgrapple.yaml"), []byte("- id: storefront\n"), 0o644))
+	assert.Error(t, RunServices(context.Background(), testLogger{}, "http://127.0.0.1:1", workDir))
+}
+
+func TestRunServicesRegistersRemoteServices(t *testing.T) {
+	proxy := &fakeProxy{}
+	proxyServer := httptest.NewServer(proxy)
+	defer proxyServer.Close()
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer remote.Close()
+
+	workDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(workDir, "webgrapple.yaml"), []byte(`
+version: 2
+services:
+  - id: storefront
+    command: [sleep, "1"]
+  - id: cms
+    type: remote
+    address: `+remote.URL+`
+`), 0o644))
+
+	require.NoError(t, RunServices(context.Background(), testLogger{}, proxyServer.URL, workDir, WithOutput(io.Discard, io.Discard)))
+	proxy.lock.Lock()
+	defer proxy.lock.Unlock()
+	assert.Contains(t, strings.Join(proxy.calls, "\n"), remote.URL)
+}
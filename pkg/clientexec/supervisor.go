@@ -0,0 +1,97 @@
+package clientexec
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RestartPolicy tells when a command is restarted after it exited
+type RestartPolicy string
+
+const (
+	RestartNever     RestartPolicy = "never"
+	RestartOnFailure RestartPolicy = "on-failure"
+	RestartAlways    RestartPolicy = "always"
+)
+
+// ParseRestartPolicy parse never, on-failure or always
+func ParseRestartPolicy(name string) (RestartPolicy, error) {
+	for _, policy := range []RestartPolicy{RestartNever, RestartOnFailure, RestartAlways} {
+		if strings.EqualFold(string(policy), name) {
+			return policy, nil
+		}
+	}
+	return "", fmt.Errorf("unknown restart policy %q, use never, on-failure or always", name)
+}
+
+// SupervisorConfig how a crashing command is restarted
+type SupervisorConfig struct {
+	Policy RestartPolicy
+	// InitialBackoff delay before the first restart, doubled for every quick crash up to MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// MaxRestarts within CrashLoopWindow, when exceeded the supervisor gives up
+	MaxRestarts     int
+	CrashLoopWindow time.Duration
+	// RestartingPage serve a "restarting" page for the services while the command is down
+	RestartingPage bool
+}
+
+// DefaultSupervisorConfig never restarts, set a Policy to change that
+func DefaultSupervisorConfig() SupervisorConfig {
+	return SupervisorConfig{
+		Policy:          RestartNever,
+		InitialBackoff:  time.Second,
+		MaxBackoff:      30 * time.Second,
+		MaxRestarts:     5,
+		CrashLoopWindow: time.Minute,
+	}
+}
+
+// supervisor decides if and when a command is restarted
+type supervisor struct {
+	config   SupervisorConfig
+	backoff  time.Duration
+	restarts int
+	recent   []time.Time
+}
+
+func newSupervisor(config SupervisorConfig) *supervisor {
+	return &supervisor{
+		config: config,
+	}
+}
+
+// next is called when the command exited after running for ran, the command is restarted after delay
+// if restart is true, an error is returned, when the command is crash looping
+func (s *supervisor) next(errWait error, ran time.Duration, now time.Time) (delay time.Duration, restart bool, err error) {
+	switch s.config.Policy {
+	case RestartAlways:
+	case RestartOnFailure:
+		if errWait == nil {
+			return 0, false, nil
+		}
+	default:
+		return 0, false, nil
+	}
+	recent := []time.Time{}
+	for _, t := range s.recent {
+		if now.Sub(t) < s.config.CrashLoopWindow {
+			recent = append(recent, t)
+		}
+	}
+	s.recent = recent
+	if s.config.MaxRestarts > 0 && len(s.recent) >= s.config.MaxRestarts {
+		return 0, false, fmt.Errorf("giving up, the command was restarted %d times within %s", len(s.recent), s.config.CrashLoopWindow)
+	}
+	s.recent = append(s.recent, now)
+	s.restarts++
+	// a command, that ran for a while, did not crash right away
+	if s.backoff == 0 || ran > s.config.MaxBackoff {
+		s.backoff = s.config.InitialBackoff
+	} else {
+		s.backoff = min(2*s.backoff, s.config.MaxBackoff)
+	}
+	return s.backoff, true, nil
+}
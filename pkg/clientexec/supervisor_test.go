@@ -0,0 +1,54 @@
+package clientexec
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupervisorNext(t *testing.T) {
+	errCrash := errors.New("exit status 1")
+	now := time.Now()
+
+	never := newSupervisor(DefaultSupervisorConfig())
+	_, restart, errGiveUp := never.next(errCrash, time.Second, now)
+	require.NoError(t, errGiveUp)
+	assert.False(t, restart)
+
+	config := DefaultSupervisorConfig()
+	config.Policy = RestartOnFailure
+	config.MaxRestarts = 3
+	onFailure := newSupervisor(config)
+	_, restart, errGiveUp = onFailure.next(nil, time.Second, now)
+	require.NoError(t, errGiveUp)
+	assert.False(t, restart, "a clean exit is not restarted on failure")
+
+	backoffs := []time.Duration{}
+	for range 3 {
+		delay, restart, errGiveUp := onFailure.next(errCrash, time.Millisecond, now)
+		require.NoError(t, errGiveUp)
+		require.True(t, restart)
+		backoffs = append(backoffs, delay)
+	}
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}, backoffs)
+	assert.Equal(t, 3, onFailure.restarts)
+
+	_, restart, errGiveUp = onFailure.next(errCrash, time.Millisecond, now)
+	assert.Error(t, errGiveUp, "crash loop")
+	assert.False(t, restart)
+
+	// the window has passed and the command ran for a while
+	delay, restart, errGiveUp := onFailure.next(errCrash, time.Hour, now.Add(2*time.Minute))
+	require.NoError(t, errGiveUp)
+	assert.True(t, restart)
+	assert.Equal(t, time.Second, delay)
+
+	policy, errParse := ParseRestartPolicy("On-Failure")
+	require.NoError(t, errParse)
+	assert.Equal(t, RestartOnFailure, policy)
+	_, errParse = ParseRestartPolicy("sometimes")
+	assert.Error(t, errParse)
+}
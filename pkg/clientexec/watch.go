@@ -0,0 +1,241 @@
+package clientexec
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	watchInterval = 500 * time.Millisecond
+	// watchDebounce wait for changes to settle, editors and compilers write several files at once
+	watchDebounce = 300 * time.Millisecond
+	// watchRescan drop the cached dir listings from time to time, in case a file system missed a dir mtime
+	watchRescan = 30 * time.Second
+)
+
+// skippedDirs are not watched, unless a glob points into them
+var skippedDirs = []string{".git", "node_modules"}
+
+// matchGlob match a slash separated name against a glob, ** matches any number of dirs
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], name[0])
+	return ok && matchSegments(pattern[1:], name[1:])
+}
+
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[\`)
+}
+
+// globBase the part of a glob without wildcards
+func globBase(pattern string) string {
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		if isGlob(segment) {
+			return strings.Join(segments[:i], "/")
+		}
+	}
+	return pattern
+}
+
+// fileState what tells a file changed
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// dirListing the watched files and the sub dirs of a dir, it is read again, when the dir mtime changes
+type dirListing struct {
+	modTime time.Time
+	files   []string
+	dirs    []string
+}
+
+// watcher polls the files matching globs in a dir, globs starting with ! exclude files
+type watcher struct {
+	dir      string
+	include  []string
+	exclude  []string
+	interval time.Duration
+	debounce time.Duration
+	// listings cache by slash separated dir names, files are stat-ed on every poll, dirs are only read,
+	// when entries were added or removed
+	listings   map[string]dirListing
+	lastRescan time.Time
+}
+
+func newWatcher(dir string, globs []string) *watcher {
+	if len(globs) == 0 {
+		return nil
+	}
+	w := &watcher{dir: dir, interval: watchInterval, debounce: watchDebounce}
+	for _, glob := range globs {
+		exclude, isExclude := strings.CutPrefix(glob, "!")
+		if isExclude {
+			glob = exclude
+		}
+		patterns := []string{path.Clean(glob)}
+		if !isGlob(glob) {
+			// a plain name may be a dir, that stands for everything in it
+			patterns = append(patterns, path.Join(glob, "**"))
+		}
+		if isExclude {
+			w.exclude = append(w.exclude, patterns...)
+		} else {
+			w.include = append(w.include, patterns...)
+		}
+	}
+	return w
+}
+
+func (w *watcher) matches(name string) bool {
+	for _, exclude := range w.exclude {
+		if matchGlob(exclude, name) {
+			return false
+		}
+	}
+	for _, include := range w.include {
+		if matchGlob(include, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshot the state of all watched files
+func (w *watcher) snapshot() map[string]fileState {
+	if w.listings == nil || time.Since(w.lastRescan) >= watchRescan {
+		w.listings = map[string]dirListing{}
+		w.lastRescan = time.Now()
+	}
+	files := map[string]fileState{}
+	visited := map[string]bool{}
+	for _, include := range w.include {
+		w.walk(path.Clean(globBase(include)), globBase(include), visited, files)
+	}
+	for name := range w.listings {
+		if !visited[name] {
+			delete(w.listings, name)
+		}
+	}
+	return files
+}
+
+// walk collect the watched files below name, listings of dirs, that did not change, are reused
+func (w *watcher) walk(name, base string, visited map[string]bool, files map[string]fileState) {
+	if visited[name] {
+		return
+	}
+	visited[name] = true
+	file := filepath.Join(w.dir, filepath.FromSlash(name))
+	info, errStat := os.Lstat(file)
+	if errStat != nil {
+		return
+	}
+	if !info.IsDir() {
+		if name != "." && w.matches(name) {
+			files[name] = fileState{modTime: info.ModTime(), size: info.Size()}
+		}
+		return
+	}
+	listing, ok := w.listings[name]
+	if !ok || !listing.modTime.Equal(info.ModTime()) {
+		entries, errRead := os.ReadDir(file)
+		if errRead != nil {
+			return
+		}
+		listing = dirListing{modTime: info.ModTime()}
+		for _, entry := range entries {
+			child := path.Join(name, entry.Name())
+			switch {
+			case !entry.IsDir():
+				if w.matches(child) {
+					listing.files = append(listing.files, child)
+				}
+			case !slices.Contains(skippedDirs, entry.Name()) || strings.HasPrefix(base, child):
+				listing.dirs = append(listing.dirs, child)
+			}
+		}
+		w.listings[name] = listing
+	}
+	for _, child := range listing.files {
+		if childInfo, errChild := os.Lstat(filepath.Join(w.dir, filepath.FromSlash(child))); errChild == nil {
+			files[child] = fileState{modTime: childInfo.ModTime(), size: childInfo.Size()}
+		}
+	}
+	for _, child := range listing.dirs {
+		w.walk(child, base, visited, files)
+	}
+}
+
+// changes names of files, that were added, changed or removed
+func changes(before, after map[string]fileState) []string {
+	changed := []string{}
+	for name, state := range after {
+		if previous, ok := before[name]; !ok || previous != state {
+			changed = append(changed, name)
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	slices.Sort(changed)
+	return changed
+}
+
+// watch poll until ctx is done, changed files are sent, once no more changes come in for the debounce time
+func (w *watcher) watch(ctx context.Context, chanChanged chan<- []string) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	current := w.snapshot()
+	pending := []string{}
+	var lastChange time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		next := w.snapshot()
+		if changed := changes(current, next); len(changed) > 0 {
+			current = next
+			pending = append(pending, changed...)
+			lastChange = time.Now()
+			continue
+		}
+		if len(pending) == 0 || time.Since(lastChange) < w.debounce {
+			continue
+		}
+		slices.Sort(pending)
+		select {
+		case chanChanged <- slices.Compact(pending):
+			pending = []string{}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
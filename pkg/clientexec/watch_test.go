@@ -0,0 +1,133 @@
+package clientexec
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchGlob(t *testing.T) {
+	for _, test := range []struct {
+		pattern, name string
+		match         bool
+	}{
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "pkg/server/run.go", true},
+		{"src/**", "src/a/b.ts", true},
+		{"src/*.ts", "src/a/b.ts", false},
+		{"src/**/*.ts", "src/b.ts", true},
+		{"*.go", "pkg/run.go", false},
+		{"**/*_test.go", "pkg/run_test.go", true},
+	} {
+		assert.Equal(t, test.match, matchGlob(test.pattern, test.name), test.pattern+" "+test.name)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "node_modules", "dep"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main"), 0o644))
+	w := newWatcher(dir, []string{"**/*.go", "!**/*_test.go"})
+	w.interval = 10 * time.Millisecond
+	w.debounce = 50 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	chanChanged := make(chan []string)
+	go w.watch(ctx, chanChanged)
+	time.Sleep(50 * time.Millisecond)
+
+	// ignored
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main_test.go"), []byte("package main"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "node_modules", "dep", "dep.go"), []byte("package dep"), 0o644))
+	// watched
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "pkg"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pkg", "pkg.go"), []byte("package pkg"), 0o644))
+	require.NoError(t, os.Remove(filepath.Join(dir, "main.go")))
+
+	select {
+	case changed := <-chanChanged:
+		assert.Equal(t, []string{"main.go", "pkg/pkg.go"}, changed)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no changes reported")
+	}
+}
+
+func TestWatcherSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	write("src/app.ts", "app")
+	write("src/lib/util.ts", "util")
+	write("src/dist/out.js", "out")
+	write("README.md", "readme")
+	write("package.json", "{}")
+	// a bare dir watches everything in it, bare files just themselves
+	w := newWatcher(dir, []string{"src", "package.json", "!src/dist"})
+
+	names := func(files map[string]fileState) []string {
+		list := []string{}
+		for name := range files {
+			list = append(list, name)
+		}
+		slices.Sort(list)
+		return list
+	}
+	first := w.snapshot()
+	assert.Equal(t, []string{"package.json", "src/app.ts", "src/lib/util.ts"}, names(first))
+	assert.Contains(t, w.listings, "src/lib")
+
+	// unchanged dirs are not read again, but their files are still checked
+	cached := w.listings["src/lib"]
+	write("src/lib/util.ts", "changed util")
+	second := w.snapshot()
+	assert.Equal(t, []string{"src/lib/util.ts"}, changes(first, second))
+	assert.Equal(t, cached.modTime, w.listings["src/lib"].modTime)
+
+	write("src/lib/deep/new.ts", "new")
+	third := w.snapshot()
+	assert.Equal(t, []string{"src/lib/deep/new.ts"}, changes(second, third))
+
+	require.NoError(t, os.RemoveAll(filepath.Join(dir, "src", "lib")))
+	fourth := w.snapshot()
+	assert.Equal(t, []string{"src/lib/deep/new.ts", "src/lib/util.ts"}, changes(third, fourth))
+	assert.NotContains(t, w.listings, "src/lib")
+	assert.NotContains(t, w.listings, "src/lib/deep")
+}
+
+func TestRunRestartsOnChanges(t *testing.T) {
+	proxyServer := httptest.NewServer(&fakeProxy{})
+	defer proxyServer.Close()
+
+	workDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(workDir, "webgrapple.yaml"), []byte("- watch: ['*.txt']\n"), 0o644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	chanErr := make(chan error, 1)
+	go func() {
+		chanErr <- Run(ctx, testLogger{}, proxyServer.URL, workDir, "sh", []string{"-c", "echo run >> runs; exec sleep 10"})
+	}()
+
+	runs := func() int {
+		data, _ := os.ReadFile(filepath.Join(workDir, "runs"))
+		return strings.Count(string(data), "run\n")
+	}
+	require.Eventually(t, func() bool { return runs() == 1 }, 5*time.Second, 50*time.Millisecond)
+	time.Sleep(time.Second)
+	require.NoError(t, os.WriteFile(filepath.Join(workDir, "hello.txt"), []byte("hello"), 0o644))
+	require.Eventually(t, func() bool { return runs() == 2 }, 5*time.Second, 50*time.Millisecond)
+
+	cancel()
+	assert.NoError(t, <-chanErr)
+}
@@ -0,0 +1,200 @@
+package clientnpm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PackageManager a node package manager
+type PackageManager string
+
+const (
+	PackageManagerNPM       PackageManager = "npm"
+	PackageManagerYarn      PackageManager = "yarn"
+	PackageManagerYarnBerry PackageManager = "yarn-berry"
+	PackageManagerPNPM      PackageManager = "pnpm"
+	PackageManagerBun       PackageManager = "bun"
+)
+
+// defaultScripts are tried in this order, when no script is given
+var defaultScripts = []string{"dev", "start"}
+
+// lockfiles tell, which package manager a project uses, yarn.lock is checked for berry
+var lockfiles = []struct {
+	name           string
+	packageManager PackageManager
+}{
+	{"pnpm-lock.yaml", PackageManagerPNPM},
+	{"bun.lockb", PackageManagerBun},
+	{"bun.lock", PackageManagerBun},
+	{"yarn.lock", PackageManagerYarn},
+	{"package-lock.json", PackageManagerNPM},
+	{"npm-shrinkwrap.json", PackageManagerNPM},
+}
+
+type packageJSON struct {
+	PackageManager string            `json:"packageManager"`
+	Scripts        map[string]string `json:"scripts"`
+}
+
+// Command the executable of the package manager
+func (pm PackageManager) Command() string {
+	if pm == PackageManagerYarnBerry {
+		return string(PackageManagerYarn)
+	}
+	return string(pm)
+}
+
+// RunArgs the args to run a script with extra args
+func (pm PackageManager) RunArgs(script string, args ...string) []string {
+	runArgs := []string{"run", script}
+	if pm == PackageManagerNPM && len(args) > 0 {
+		// npm does not pass on args without a separator
+		runArgs = append(runArgs, "--")
+	}
+	return append(runArgs, args...)
+}
+
+// DetectPackageManager by the packageManager field in package.json or by the lockfile in dir or one of
+// its parents, as workspaces of a monorepo share them, npm is the default
+func DetectPackageManager(dir string) (PackageManager, error) {
+	absDir, errAbs := filepath.Abs(dir)
+	if errAbs != nil {
+		return "", errAbs
+	}
+	for {
+		pkg, errRead := readPackageJSON(absDir)
+		if errRead != nil && !os.IsNotExist(errRead) {
+			return "", errRead
+		}
+		if pkg != nil && pkg.PackageManager != "" {
+			return parsePackageManagerField(pkg.PackageManager)
+		}
+		for _, lockfile := range lockfiles {
+			if _, errStat := os.Stat(filepath.Join(absDir, lockfile.name)); errStat != nil {
+				continue
+			}
+			if lockfile.packageManager == PackageManagerYarn && isYarnBerry(absDir) {
+				return PackageManagerYarnBerry, nil
+			}
+			return lockfile.packageManager, nil
+		}
+		parent := filepath.Dir(absDir)
+		if parent == absDir {
+			return PackageManagerNPM, nil
+		}
+		absDir = parent
+	}
+}
+
+// parsePackageManagerField the packageManager field of corepack like yarn@4.1.0
+func parsePackageManagerField(field string) (PackageManager, error) {
+	name, version, _ := strings.Cut(field, "@")
+	switch pm := PackageManager(name); pm {
+	case PackageManagerYarn:
+		if version != "" && !strings.HasPrefix(version, "1.") {
+			return PackageManagerYarnBerry, nil
+		}
+		return pm, nil
+	case PackageManagerNPM, PackageManagerPNPM, PackageManagerBun:
+		return pm, nil
+	default:
+		return "", fmt.Errorf("unsupported packageManager %q in package.json", field)
+	}
+}
+
+// isYarnBerry yarn 2+ has a .yarnrc.yml and metadata in its lockfile
+func isYarnBerry(dir string) bool {
+	if _, errStat := os.Stat(filepath.Join(dir, ".yarnrc.yml")); errStat == nil {
+		return true
+	}
+	lock, errRead := os.ReadFile(filepath.Join(dir, "yarn.lock"))
+	return errRead == nil && strings.Contains(string(lock), "__metadata:")
+}
+
+// ReadScripts the scripts of package.json in dir
+func ReadScripts(dir string) (map[string]string, error) {
+	pkg, errRead := readPackageJSON(dir)
+	if errRead != nil {
+		return nil, errRead
+	}
+	return pkg.Scripts, nil
+}
+
+func readPackageJSON(dir string) (*packageJSON, error) {
+	data, errRead := os.ReadFile(filepath.Join(dir, "package.json"))
+	if errRead != nil {
+		return nil, errRead
+	}
+	pkg := &packageJSON{}
+	if errUnmarshal := json.Unmarshal(data, pkg); errUnmarshal != nil {
+		return nil, fmt.Errorf("invalid package.json: %w", errUnmarshal)
+	}
+	return pkg, nil
+}
+
+// ResolveCommand what to run for the args of client-npm, the first arg is a script from package.json,
+// scripts are run with the package manager of the project, without args dev or start is run,
+// paths and executables like yarn or node, that are not scripts, are run as they are
+func ResolveCommand(workDir string, args []string) (command string, commandArgs []string, err error) {
+	if len(args) > 0 && strings.ContainsRune(args[0], filepath.Separator) {
+		return args[0], args[1:], nil
+	}
+	scripts, errScripts := ReadScripts(workDir)
+	script := ""
+	if len(args) > 0 {
+		script = args[0]
+		// scripts like test or build win over executables of the same name
+		if _, ok := scripts[script]; !ok {
+			if isExecutable(script) {
+				return args[0], args[1:], nil
+			}
+			if errScripts != nil {
+				return "", nil, fmt.Errorf("could not read scripts: %w", errScripts)
+			}
+			return "", nil, fmt.Errorf("there is no script %q in package.json, available scripts: %s", script, listScripts(scripts))
+		}
+		args = args[1:]
+	} else {
+		if errScripts != nil {
+			return "", nil, fmt.Errorf("could not read scripts: %w", errScripts)
+		}
+		for _, defaultScript := range defaultScripts {
+			if _, ok := scripts[defaultScript]; ok {
+				script = defaultScript
+				break
+			}
+		}
+		if script == "" {
+			return "", nil, fmt.Errorf("package.json has neither a dev nor a start script, pick one of: %s", listScripts(scripts))
+		}
+	}
+	pm, errDetect := DetectPackageManager(workDir)
+	if errDetect != nil {
+		return "", nil, errDetect
+	}
+	return pm.Command(), pm.RunArgs(script, args...), nil
+}
+
+// isExecutable a command in PATH
+func isExecutable(name string) bool {
+	_, errLookPath := exec.LookPath(name)
+	return errLookPath == nil
+}
+
+func listScripts(scripts map[string]string) string {
+	if len(scripts) == 0 {
+		return "none"
+	}
+	names := make([]string, 0, len(scripts))
+	for name := range scripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,103 @@
+package clientnpm
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+}
+
+func TestDetectPackageManager(t *testing.T) {
+	for name, test := range map[string]struct {
+		files   map[string]string
+		want    PackageManager
+		workDir string
+	}{
+		"npm":            {map[string]string{"package-lock.json": "{}"}, PackageManagerNPM, ""},
+		"none":           {map[string]string{"package.json": "{}"}, PackageManagerNPM, ""},
+		"pnpm":           {map[string]string{"pnpm-lock.yaml": ""}, PackageManagerPNPM, ""},
+		"bun":            {map[string]string{"bun.lockb": ""}, PackageManagerBun, ""},
+		"yarn classic":   {map[string]string{"yarn.lock": "# yarn lockfile v1\n"}, PackageManagerYarn, ""},
+		"yarn berry":     {map[string]string{"yarn.lock": "__metadata:\n  version: 8\n"}, PackageManagerYarnBerry, ""},
+		"yarnrc":         {map[string]string{"yarn.lock": "", ".yarnrc.yml": ""}, PackageManagerYarnBerry, ""},
+		"packageManager": {map[string]string{"package.json": `{"packageManager": "pnpm@9.1.0"}`, "yarn.lock": ""}, PackageManagerPNPM, ""},
+		"monorepo":       {map[string]string{"pnpm-lock.yaml": "", "apps/web/package.json": "{}"}, PackageManagerPNPM, "apps/web"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, test.files)
+			pm, errDetect := DetectPackageManager(filepath.Join(dir, test.workDir))
+			require.NoError(t, errDetect)
+			assert.Equal(t, test.want, pm)
+		})
+	}
+}
+
+func TestResolveCommand(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"package.json":      `{"scripts": {"start": "node server.js", "storybook": "storybook dev"}}`,
+		"package-lock.json": "{}",
+	})
+
+	command, args, errResolve := ResolveCommand(dir, nil)
+	require.NoError(t, errResolve)
+	assert.Equal(t, "npm", command)
+	assert.Equal(t, []string{"run", "start"}, args)
+
+	command, args, errResolve = ResolveCommand(dir, []string{"storybook", "--port", "6006"})
+	require.NoError(t, errResolve)
+	assert.Equal(t, "npm", command)
+	assert.Equal(t, []string{"run", "storybook", "--", "--port", "6006"}, args)
+
+	_, _, errResolve = ResolveCommand(dir, []string{"lint"})
+	assert.ErrorContains(t, errResolve, "start, storybook")
+
+	command, args, errResolve = ResolveCommand(dir, []string{"sh", "-c", "true"})
+	require.NoError(t, errResolve)
+	assert.Equal(t, "sh", command)
+	assert.Equal(t, []string{"-c", "true"}, args)
+}
+
+func TestResolveCommandScriptsWinOverExecutables(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"package.json": `{"scripts": {"test": "vitest", "sh": "echo not a shell"}}`,
+		"yarn.lock":    "",
+	})
+	for _, name := range []string{"test", "sh"} {
+		_, errLookPath := exec.LookPath(name)
+		require.NoError(t, errLookPath, "the collision needs %q in PATH", name)
+		command, args, errResolve := ResolveCommand(dir, []string{name, "--watch"})
+		require.NoError(t, errResolve)
+		assert.Equal(t, "yarn", command)
+		assert.Equal(t, []string{"run", name, "--watch"}, args)
+	}
+
+	// paths are never scripts
+	command, args, errResolve := ResolveCommand(dir, []string{"./test", "-x"})
+	require.NoError(t, errResolve)
+	assert.Equal(t, "./test", command)
+	assert.Equal(t, []string{"-x"}, args)
+
+	// executables work without a package.json
+	empty := t.TempDir()
+	command, _, errResolve = ResolveCommand(empty, []string{"sh"})
+	require.NoError(t, errResolve)
+	assert.Equal(t, "sh", command)
+	_, _, errResolve = ResolveCommand(empty, []string{"no-such-script-or-binary"})
+	assert.ErrorContains(t, errResolve, "could not read scripts")
+	_, _, errResolve = ResolveCommand(empty, nil)
+	assert.ErrorContains(t, errResolve, "could not read scripts")
+}
@@ -0,0 +1,85 @@
+package clientnpm
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/foomo/webgrapple/pkg/log"
+)
+
+var jetbrainsFileNameRe = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// jetbrainsRunConfiguration an "Attach to Node.js/Chrome" run configuration of WebStorm and IntelliJ
+type jetbrainsRunConfiguration struct {
+	XMLName       xml.Name `xml:"component"`
+	Name          string   `xml:"name,attr"`
+	Configuration struct {
+		Default             bool   `xml:"default,attr"`
+		Name                string `xml:"name,attr"`
+		Type                string `xml:"type,attr"`
+		FactoryName         string `xml:"factoryName,attr"`
+		Host                string `xml:"host,attr"`
+		Port                int    `xml:"port,attr"`
+		RestartOnDisconnect bool   `xml:"restartOnDisconnect,attr"`
+		Method              struct {
+			V int `xml:"v,attr"`
+		} `xml:"method"`
+	} `xml:"configuration"`
+}
+
+func jetbrainsDebugConfig(name string, debugPort int) ([]byte, error) {
+	c := jetbrainsRunConfiguration{Name: "ProjectRunConfigurationManager"}
+	c.Configuration.Name = "webgrapple-npm " + name
+	c.Configuration.Type = "ChromiumRemoteDebugType"
+	c.Configuration.FactoryName = "Chromium Remote"
+	c.Configuration.Host = "127.0.0.1"
+	c.Configuration.Port = debugPort
+	// the command is restarted by the supervisor
+	c.Configuration.RestartOnDisconnect = true
+	c.Configuration.Method.V = 2
+	data, errMarshal := xml.MarshalIndent(c, "", "  ")
+	if errMarshal != nil {
+		return nil, errMarshal
+	}
+	return append(data, '\n'), nil
+}
+
+// jetbrainsProjectDir the closest dir with an .idea dir, path itself, if there is none
+func jetbrainsProjectDir(path string) string {
+	for dir := path; ; {
+		if info, errStat := os.Stat(filepath.Join(dir, ".idea")); errStat == nil && info.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return path
+		}
+		dir = parent
+	}
+}
+
+// JetBrainsDebug write a run configuration to attach WebStorm or IntelliJ to the debug port into
+// .idea/runConfigurations of the project
+func JetBrainsDebug(logger log.Logger, path, name string, debugPort int) error {
+	absPath, errAbs := filepath.Abs(path)
+	if errAbs != nil {
+		return errAbs
+	}
+	data, errConfig := jetbrainsDebugConfig(name, debugPort)
+	if errConfig != nil {
+		return errConfig
+	}
+	dir := filepath.Join(jetbrainsProjectDir(absPath), ".idea", "runConfigurations")
+	if errMkdir := os.MkdirAll(dir, 0o755); errMkdir != nil {
+		return errMkdir
+	}
+	file := filepath.Join(dir, "webgrapple_npm_"+jetbrainsFileNameRe.ReplaceAllString(name, "_")+".xml")
+	if errWrite := os.WriteFile(file, data, 0o644); errWrite != nil {
+		return errWrite
+	}
+	logger.Info(fmt.Sprintf("wrote run configuration %q to %q, start it to attach the debugger", "webgrapple-npm "+name, file))
+	return nil
+}
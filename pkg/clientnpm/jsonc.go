@@ -0,0 +1,342 @@
+package clientnpm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// jsoncValue a value in a JSON with comments document, like vscode settings, with its position,
+// so that it can be edited in place without losing comments and formatting
+type jsoncValue struct {
+	// start and end of the value in the document
+	start, end int
+	// kind is the first byte of the value, { [ " or the first byte of a literal
+	kind     byte
+	members  []jsoncMember
+	elements []*jsoncValue
+}
+
+type jsoncMember struct {
+	key   string
+	value *jsoncValue
+}
+
+type jsoncParser struct {
+	src []byte
+	pos int
+}
+
+func parseJSONC(src []byte) (*jsoncValue, error) {
+	p := &jsoncParser{src: src}
+	v, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	if errSpace := p.space(); errSpace != nil {
+		return nil, errSpace
+	}
+	if p.pos < len(p.src) {
+		return nil, p.errorf("unexpected content after the value")
+	}
+	return v, nil
+}
+
+func (p *jsoncParser) errorf(format string, a ...interface{}) error {
+	line := bytes.Count(p.src[:min(p.pos, len(p.src))], []byte("\n")) + 1
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, a...))
+}
+
+// space skip white space and comments
+func (p *jsoncParser) space() error {
+	for p.pos < len(p.src) {
+		switch {
+		case strings.IndexByte(" \t\r\n", p.src[p.pos]) >= 0:
+			p.pos++
+		case bytes.HasPrefix(p.src[p.pos:], []byte("//")):
+			end := bytes.IndexByte(p.src[p.pos:], '\n')
+			if end < 0 {
+				p.pos = len(p.src)
+			} else {
+				p.pos += end + 1
+			}
+		case bytes.HasPrefix(p.src[p.pos:], []byte("/*")):
+			end := bytes.Index(p.src[p.pos+2:], []byte("*/"))
+			if end < 0 {
+				return p.errorf("unterminated comment")
+			}
+			p.pos += end + 4
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (p *jsoncParser) value() (*jsoncValue, error) {
+	if errSpace := p.space(); errSpace != nil {
+		return nil, errSpace
+	}
+	if p.pos >= len(p.src) {
+		return nil, p.errorf("unexpected end")
+	}
+	v := &jsoncValue{start: p.pos, kind: p.src[p.pos]}
+	switch v.kind {
+	case '{':
+		p.pos++
+		for {
+			if errSpace := p.space(); errSpace != nil {
+				return nil, errSpace
+			}
+			if p.pos < len(p.src) && p.src[p.pos] == '}' {
+				p.pos++
+				break
+			}
+			key, errKey := p.value()
+			if errKey != nil {
+				return nil, errKey
+			}
+			if key.kind != '"' {
+				return nil, p.errorf("expected a key")
+			}
+			if errSpace := p.space(); errSpace != nil {
+				return nil, errSpace
+			}
+			if p.pos >= len(p.src) || p.src[p.pos] != ':' {
+				return nil, p.errorf("expected :")
+			}
+			p.pos++
+			memberValue, errValue := p.value()
+			if errValue != nil {
+				return nil, errValue
+			}
+			v.members = append(v.members, jsoncMember{key: p.stringValue(key), value: memberValue})
+			if errDelimiter := p.delimiter('}'); errDelimiter != nil {
+				return nil, errDelimiter
+			}
+		}
+	case '[':
+		p.pos++
+		for {
+			if errSpace := p.space(); errSpace != nil {
+				return nil, errSpace
+			}
+			if p.pos < len(p.src) && p.src[p.pos] == ']' {
+				p.pos++
+				break
+			}
+			element, errElement := p.value()
+			if errElement != nil {
+				return nil, errElement
+			}
+			v.elements = append(v.elements, element)
+			if errDelimiter := p.delimiter(']'); errDelimiter != nil {
+				return nil, errDelimiter
+			}
+		}
+	case '"':
+		p.pos++
+		for p.pos < len(p.src) && p.src[p.pos] != '"' {
+			if p.src[p.pos] == '\\' {
+				p.pos++
+			}
+			p.pos++
+		}
+		if p.pos >= len(p.src) {
+			return nil, p.errorf("unterminated string")
+		}
+		p.pos++
+	default:
+		for p.pos < len(p.src) && strings.IndexByte(",:]} \t\r\n/", p.src[p.pos]) < 0 {
+			p.pos++
+		}
+		if p.pos == v.start {
+			return nil, p.errorf("unexpected %q", p.src[p.pos])
+		}
+	}
+	v.end = p.pos
+	return v, nil
+}
+
+// delimiter after a member or element, trailing commas are fine
+func (p *jsoncParser) delimiter(closing byte) error {
+	if errSpace := p.space(); errSpace != nil {
+		return errSpace
+	}
+	switch {
+	case p.pos < len(p.src) && p.src[p.pos] == ',':
+		p.pos++
+		return nil
+	case p.pos < len(p.src) && p.src[p.pos] == closing:
+		return nil
+	default:
+		return p.errorf("expected , or %q", closing)
+	}
+}
+
+func (p *jsoncParser) stringValue(v *jsoncValue) string {
+	s := ""
+	_ = json.Unmarshal(p.src[v.start:v.end], &s)
+	return s
+}
+
+func (v *jsoncValue) member(key string) *jsoncValue {
+	for _, m := range v.members {
+		if m.key == key {
+			return m.value
+		}
+	}
+	return nil
+}
+
+// jsoncIndent the indentation unit of a document, tabs or the smallest number of spaces
+func jsoncIndent(src []byte) string {
+	unit := ""
+	for _, line := range strings.Split(string(src), "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" || len(trimmed) == len(line) {
+			continue
+		}
+		indent := line[:len(line)-len(trimmed)]
+		if strings.HasPrefix(indent, "\t") {
+			return "\t"
+		}
+		if unit == "" || len(indent) < len(unit) {
+			unit = indent
+		}
+	}
+	if unit == "" {
+		return "\t"
+	}
+	return unit
+}
+
+// lineIndent the indentation of the line at pos
+func lineIndent(src []byte, pos int) string {
+	start := bytes.LastIndexByte(src[:pos], '\n') + 1
+	end := start
+	for end < len(src) && (src[end] == ' ' || src[end] == '\t') {
+		end++
+	}
+	return string(src[start:end])
+}
+
+// jsoncInsert add text as the last member or element of the object or array container
+func jsoncInsert(src []byte, container *jsoncValue, text string) []byte {
+	unit := jsoncIndent(src)
+	outer := lineIndent(src, container.start)
+	inner := outer + unit
+	text = indentFollowingLines(text, inner)
+	var last *jsoncValue
+	if len(container.members) > 0 {
+		last = container.members[len(container.members)-1].value
+	} else if len(container.elements) > 0 {
+		last = container.elements[len(container.elements)-1]
+	}
+	if last == nil {
+		closing := container.end - 1
+		// an empty container may still have comments
+		start := container.start + 1 + len(bytes.TrimRight(src[container.start+1:closing], " \t\r\n"))
+		return splice(src, start, closing, "\n"+inner+text+"\n"+outer)
+	}
+	// keep a trailing comma of the last one
+	p := &jsoncParser{src: src, pos: last.end}
+	_ = p.space()
+	trailingComma := p.pos < len(src) && src[p.pos] == ','
+	pos := last.end
+	if trailingComma {
+		pos = p.pos + 1
+	}
+	// and a comment in the same line
+	rest := bytes.TrimLeft(src[pos:], " \t")
+	if bytes.HasPrefix(rest, []byte("//")) {
+		pos = len(src) - len(rest)
+		if end := bytes.IndexByte(rest, '\n'); end >= 0 {
+			pos += end
+		}
+	}
+	if trailingComma {
+		return splice(src, pos, pos, "\n"+inner+text+",")
+	}
+	return splice(splice(src, pos, pos, "\n"+inner+text), last.end, last.end, ",")
+}
+
+// jsoncReplace replace a value with text
+func jsoncReplace(src []byte, v *jsoncValue, text string) []byte {
+	return splice(src, v.start, v.end, indentFollowingLines(text, lineIndent(src, v.start)))
+}
+
+func indentFollowingLines(text, indent string) string {
+	return strings.ReplaceAll(text, "\n", "\n"+indent)
+}
+
+func splice(src []byte, start, end int, text string) []byte {
+	result := make([]byte, 0, len(src)+len(text))
+	result = append(result, src[:start]...)
+	result = append(result, text...)
+	return append(result, src[end:]...)
+}
+
+// jsoncMarshal marshal a value with the indentation of the document
+func jsoncMarshal(src []byte, v interface{}) (string, error) {
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", jsoncIndent(src))
+	if errEncode := encoder.Encode(v); errEncode != nil {
+		return "", errEncode
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// jsoncUpsertNamed put entry into the array at path, replacing an element with the same name, missing
+// objects and the array on the path are created
+func jsoncUpsertNamed(src []byte, path []string, name string, entry interface{}) ([]byte, error) {
+	root, errParse := parseJSONC(src)
+	if errParse != nil {
+		return nil, errParse
+	}
+	if root.kind != '{' {
+		return nil, fmt.Errorf("expected an object")
+	}
+	container := root
+	for i, key := range path {
+		next := container.member(key)
+		if next == nil {
+			// create what is missing from here
+			var missing interface{} = []interface{}{entry}
+			for j := len(path) - 1; j > i; j-- {
+				missing = map[string]interface{}{path[j]: missing}
+			}
+			text, errMarshal := jsoncMarshal(src, missing)
+			if errMarshal != nil {
+				return nil, errMarshal
+			}
+			keyText, _ := json.Marshal(key)
+			return jsoncInsert(src, container, string(keyText)+": "+text), nil
+		}
+		wantKind := byte('{')
+		if i == len(path)-1 {
+			wantKind = '['
+		}
+		if next.kind != wantKind {
+			return nil, fmt.Errorf("unexpected type of %q", strings.Join(path[:i+1], "."))
+		}
+		container = next
+	}
+	text, errMarshal := jsoncMarshal(src, entry)
+	if errMarshal != nil {
+		return nil, errMarshal
+	}
+	p := &jsoncParser{src: src}
+	for _, element := range container.elements {
+		if element.kind != '{' {
+			continue
+		}
+		if elementName := element.member("name"); elementName != nil && elementName.kind == '"' && p.stringValue(elementName) == name {
+			return jsoncReplace(src, element, text), nil
+		}
+	}
+	return jsoncInsert(src, container, text), nil
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
 
 	"github.com/foomo/webgrapple/pkg/log"
@@ -40,19 +41,90 @@ func vscodeGetTarget(path string) string {
 	return path
 }
 
-func vscodeDebugConfig(name string, debugPort int) (config string, err error) {
-	launchData := map[string]interface{}{
-		"sourceMaps": true,
-		"type":       "node",
-		"request":    "attach",
-		"name":       "webgrapple-npm " + name,
-		"port":       debugPort,
+// vscodeLaunchConfig attach configuration in launch.json
+type vscodeLaunchConfig struct {
+	Type       string   `json:"type"`
+	Request    string   `json:"request"`
+	Name       string   `json:"name"`
+	Address    string   `json:"address"`
+	Port       int      `json:"port"`
+	Restart    bool     `json:"restart"`
+	SourceMaps bool     `json:"sourceMaps"`
+	SkipFiles  []string `json:"skipFiles"`
+}
+
+func vscodeDebugConfig(name string, debugPort int) vscodeLaunchConfig {
+	return vscodeLaunchConfig{
+		Type:    "node",
+		Request: "attach",
+		Name:    "webgrapple-npm " + name,
+		Address: "127.0.0.1",
+		Port:    debugPort,
+		// the command is restarted by the supervisor
+		Restart:    true,
+		SourceMaps: true,
+		SkipFiles:  []string{"<node_internals>/**"},
 	}
-	launchJSONBytes, errMarshal := json.Marshal(launchData)
-	if errMarshal != nil {
-		return "", errMarshal
+}
+
+// vscodeWriteLaunchConfig add or update the attach configuration in the launch section of the workspace file
+// or in .vscode/launch.json, comments and other configurations are kept
+func vscodeWriteLaunchConfig(target string, config vscodeLaunchConfig) (file string, err error) {
+	path := []string{"launch", "configurations"}
+	file = target
+	if !strings.HasSuffix(target, ".code-workspace") {
+		path = []string{"configurations"}
+		file = filepath.Join(target, ".vscode", "launch.json")
+	}
+	src, errRead := os.ReadFile(file)
+	mode := os.FileMode(0o644)
+	switch {
+	case os.IsNotExist(errRead):
+		if errMkdir := os.MkdirAll(filepath.Dir(file), 0o755); errMkdir != nil {
+			return "", errMkdir
+		}
+		src = []byte("{\n\t\"version\": \"0.2.0\",\n\t\"configurations\": []\n}\n")
+	case errRead != nil:
+		return "", errRead
+	default:
+		if info, errStat := os.Stat(file); errStat == nil {
+			mode = info.Mode().Perm()
+		}
+	}
+	if path[0] == "launch" {
+		root, errParse := parseJSONC(src)
+		if errParse != nil {
+			return "", errorWrap(errParse, "could not parse "+file)
+		}
+		if root.kind == '{' && root.member("launch") == nil {
+			// a launch section needs a version
+			launch, errMarshal := jsoncMarshal(src, struct {
+				Version        string               `json:"version"`
+				Configurations []vscodeLaunchConfig `json:"configurations"`
+			}{"0.2.0", []vscodeLaunchConfig{config}})
+			if errMarshal != nil {
+				return "", errMarshal
+			}
+			return file, os.WriteFile(file, jsoncInsert(src, root, "\"launch\": "+launch), mode)
+		}
+	}
+	updated, errUpsert := jsoncUpsertNamed(src, path, config.Name, config)
+	if errUpsert != nil {
+		return "", errorWrap(errUpsert, "could not update "+file)
+	}
+	return file, os.WriteFile(file, updated, mode)
+}
+
+// openURL open a url with the default handler of the desktop
+func openURL(u string) *exec.Cmd {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", u)
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", u)
+	default:
+		return exec.Command("xdg-open", u)
 	}
-	return string(launchJSONBytes), nil
 }
 
 func vscodedebug(logger log.Logger, path, name string, debugPort int) error {
@@ -62,11 +134,18 @@ func vscodedebug(logger log.Logger, path, name string, debugPort int) error {
 	}
 	vscodeTarget := vscodeGetTarget(absPath)
 
-	debugConfig, errDebugConfig := vscodeDebugConfig(name, debugPort)
-	if errDebugConfig != nil {
-		return errDebugConfig
+	debugConfig := vscodeDebugConfig(name, debugPort)
+	launchFile, errWrite := vscodeWriteLaunchConfig(vscodeTarget, debugConfig)
+	if errWrite != nil {
+		return errWrite
+	}
+	logger.Info(fmt.Sprintf("wrote debug configuration %q to %q", debugConfig.Name, launchFile))
+	debugConfigJSON, errMarshal := json.Marshal(debugConfig)
+	if errMarshal != nil {
+		return errMarshal
 	}
 
+	// the attach configuration restarts on its own, so the session has to be started only once
 	go func() {
 		logger.Info("starting vscode")
 		launchOutput, errLaunch := exec.Command("code", vscodeTarget).CombinedOutput()
@@ -81,17 +160,18 @@ func vscodedebug(logger log.Logger, path, name string, debugPort int) error {
 				}
 				logger.Info("waiting for vscode to start...")
 			}
-			if launchedVSCode {
-				logger.Info(fmt.Sprintf("launching vscode: %s", debugConfig))
-				combinedOut, errRun := exec.Command(
-					"open",
-					"vscode://fabiospampinato.vscode-debug-launcher/launch?args="+url.PathEscape(
-						debugConfig,
+			if !launchedVSCode {
+				logger.Error(fmt.Sprintf("vscode did not come up, start %q from the debug view", debugConfig.Name))
+			} else {
+				logger.Info(fmt.Sprintf("launching vscode: %s", debugConfigJSON))
+				combinedOut, errRun := openURL(
+					"vscode://fabiospampinato.vscode-debug-launcher/launch?args=" + url.PathEscape(
+						string(debugConfigJSON),
 					)).CombinedOutput()
 				if errRun != nil {
-					logger.Error("could not start vscode %q", string(combinedOut))
+					logger.Error(fmt.Sprintf("could not start the vscode debug session %q, start %q from the debug view: %v", string(combinedOut), debugConfig.Name, errRun))
 				} else {
-					logger.Info("started vscode session %q", string(combinedOut))
+					logger.Info(fmt.Sprintf("started vscode session %q", string(combinedOut)))
 				}
 			}
 		} else {
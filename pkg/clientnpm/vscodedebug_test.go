@@ -0,0 +1,116 @@
+package clientnpm
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const launchJSON = `{
+    // keep me
+    "version": "0.2.0",
+    "configurations": [
+        {
+            "name": "tests", /* and me */
+            "type": "node",
+            "request": "launch",
+        },
+    ]
+}
+`
+
+func TestVSCodeWriteLaunchConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{".vscode/launch.json": launchJSON})
+
+	file, errWrite := vscodeWriteLaunchConfig(dir, vscodeDebugConfig("storefront", 9229))
+	require.NoError(t, errWrite)
+	assert.Equal(t, filepath.Join(dir, ".vscode", "launch.json"), file)
+	_, errWrite = vscodeWriteLaunchConfig(dir, vscodeDebugConfig("storefront", 9230))
+	require.NoError(t, errWrite)
+
+	updated, errRead := os.ReadFile(file)
+	require.NoError(t, errRead)
+	launch := string(updated)
+	assert.Contains(t, launch, "// keep me")
+	assert.Contains(t, launch, "/* and me */")
+	assert.Contains(t, launch, `"name": "tests"`)
+	assert.Equal(t, 1, strings.Count(launch, `"webgrapple-npm storefront"`))
+	assert.Contains(t, launch, "\n            \"port\": 9230,\n")
+	assert.NotContains(t, launch, "9229")
+	_, errParse := parseJSONC(updated)
+	assert.NoError(t, errParse)
+}
+
+func TestVSCodeWriteLaunchConfigWorkspace(t *testing.T) {
+	dir := t.TempDir()
+	workspace := filepath.Join(dir, "shop.code-workspace")
+	writeFiles(t, dir, map[string]string{"shop.code-workspace": "{\n\t\"folders\": [{\"path\": \".\"}], // root\n}\n"})
+
+	file, errWrite := vscodeWriteLaunchConfig(workspace, vscodeDebugConfig("storefront", 9229))
+	require.NoError(t, errWrite)
+	assert.Equal(t, workspace, file)
+	updated, errRead := os.ReadFile(file)
+	require.NoError(t, errRead)
+	assert.Contains(t, string(updated), "// root")
+
+	root, errParse := parseJSONC(updated)
+	require.NoError(t, errParse)
+	launch := root.member("launch")
+	require.NotNil(t, launch)
+	assert.NotNil(t, launch.member("version"))
+	require.Len(t, launch.member("configurations").elements, 1)
+}
+
+func TestVSCodeWriteLaunchConfigCreates(t *testing.T) {
+	dir := t.TempDir()
+	file, errWrite := vscodeWriteLaunchConfig(dir, vscodeDebugConfig("storefront", 9229))
+	require.NoError(t, errWrite)
+	created, errRead := os.ReadFile(file)
+	require.NoError(t, errRead)
+	root, errParse := parseJSONC(created)
+	require.NoError(t, errParse)
+	require.Len(t, root.member("configurations").elements, 1)
+}
+
+func TestJetBrainsDebug(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".idea"), 0o755))
+	workDir := filepath.Join(dir, "apps", "storefront")
+	require.NoError(t, os.MkdirAll(workDir, 0o755))
+
+	require.NoError(t, JetBrainsDebug(testLogger{}, workDir, "store front", 9229))
+	config, errRead := os.ReadFile(filepath.Join(dir, ".idea", "runConfigurations", "webgrapple_npm_store_front.xml"))
+	require.NoError(t, errRead)
+	assert.Contains(t, string(config), `<component name="ProjectRunConfigurationManager">`)
+	assert.Contains(t, string(config), `name="webgrapple-npm store front" type="ChromiumRemoteDebugType" factoryName="Chromium Remote" host="127.0.0.1" port="9229"`)
+}
+
+type testLogger struct{}
+
+func (testLogger) Info(a ...interface{})  {}
+func (testLogger) Error(a ...interface{}) {}
+
+func TestJSONCUpsertNamedEmpty(t *testing.T) {
+	updated, errUpsert := jsoncUpsertNamed([]byte("{\n  \"configurations\": [\n    // none yet\n  ]\n}\n"), []string{"configurations"}, "a", map[string]string{"name": "a"})
+	require.NoError(t, errUpsert)
+	assert.Equal(t, "{\n  \"configurations\": [\n    // none yet\n    {\n      \"name\": \"a\"\n    }\n  ]\n}\n", string(updated))
+}
+
+func TestOpenURL(t *testing.T) {
+	const u = "vscode://fabiospampinato.vscode-debug-launcher/launch"
+	want := map[string][]string{
+		"darwin":  {"open", u},
+		"windows": {"rundll32", "url.dll,FileProtocolHandler", u},
+		"linux":   {"xdg-open", u},
+	}[runtime.GOOS]
+	if want == nil {
+		want = []string{"xdg-open", u}
+	}
+	assert.Equal(t, want, openURL(u).Args)
+}
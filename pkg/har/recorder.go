@@ -0,0 +1,455 @@
+package har
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/foomo/webgrapple/pkg/vo"
+)
+
+const (
+	// TargetBackend entries for the fallback backend
+	TargetBackend = "backend"
+	// TargetService entries for registered services
+	TargetService = "service"
+
+	redacted = "[redacted]"
+)
+
+// DefaultMaxBodySize bodies will be truncated to this size
+const DefaultMaxBodySize int64 = 1024 * 1024
+
+// DefaultRedactHeaders header values, that will not be written to HAR files
+var DefaultRedactHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+}
+
+// ErrNotRecording stop was called without a running capture
+var ErrNotRecording = errors.New("not recording")
+
+// Config for a Recorder
+type Config struct {
+	// Dir where HAR files are written to
+	Dir string
+	// MaxBodySize request and response bodies are truncated to this size, a negative value disables bodies
+	MaxBodySize int64
+	// RedactHeaders names of headers, whose values must not be recorded
+	RedactHeaders []string
+}
+
+// ServiceIDResolver tells, which service a request is sent to
+type ServiceIDResolver func(r *http.Request) vo.ServiceID
+
+// Recorder records proxied traffic into HAR files
+type Recorder struct {
+	config  Config
+	redact  map[string]struct{}
+	lock    sync.Mutex
+	log     *Log
+	started time.Time
+}
+
+// NewRecorder create a recorder, it will not record until Start is called
+func NewRecorder(config Config) *Recorder {
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = DefaultMaxBodySize
+	}
+	if config.RedactHeaders == nil {
+		config.RedactHeaders = DefaultRedactHeaders
+	}
+	redact := map[string]struct{}{}
+	for _, name := range config.RedactHeaders {
+		redact[http.CanonicalHeaderKey(name)] = struct{}{}
+	}
+	return &Recorder{
+		config: config,
+		redact: redact,
+	}
+}
+
+func creatorVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "devel"
+}
+
+// Recording tells if a capture is running
+func (rec *Recorder) Recording() bool {
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+	return rec.log != nil
+}
+
+// Start a new capture, a running capture will be continued
+func (rec *Recorder) Start() {
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+	if rec.log != nil {
+		return
+	}
+	rec.started = time.Now()
+	rec.log = &Log{
+		Version: Version,
+		Creator: &Creator{
+			Name:    "webgrapple",
+			Version: creatorVersion(),
+		},
+		Entries: []*Entry{},
+	}
+}
+
+// Stop the running capture and write it to a HAR file
+func (rec *Recorder) Stop() (file string, entries int, err error) {
+	rec.lock.Lock()
+	harLog := rec.log
+	started := rec.started
+	rec.log = nil
+	if harLog == nil {
+		rec.lock.Unlock()
+		return "", 0, ErrNotRecording
+	}
+	// request bodies of recorded entries are finalized under the lock
+	harBytes, errMarshal := json.MarshalIndent(&File{Log: harLog}, "", "  ")
+	rec.lock.Unlock()
+	if errMarshal != nil {
+		return "", 0, errMarshal
+	}
+	file, errWrite := writeNewFile(rec.config.Dir, "webgrapple-"+started.Format("20060102-150405.000"), ".har", harBytes)
+	if errWrite != nil {
+		return "", 0, errWrite
+	}
+	return file, len(harLog.Entries), nil
+}
+
+// writeNewFile never overwrites an earlier capture, a suffix is added, if the name is taken
+func writeNewFile(dir, name, ext string, data []byte) (string, error) {
+	for i := 0; ; i++ {
+		file := filepath.Join(dir, name+ext)
+		if i > 0 {
+			file = filepath.Join(dir, fmt.Sprintf("%s-%d%s", name, i, ext))
+		}
+		f, errOpen := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if errors.Is(errOpen, os.ErrExist) {
+			continue
+		}
+		if errOpen != nil {
+			return "", errOpen
+		}
+		_, errWrite := f.Write(data)
+		if errClose := f.Close(); errWrite == nil {
+			errWrite = errClose
+		}
+		return file, errWrite
+	}
+}
+
+func (rec *Recorder) add(entry *Entry) {
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+	if rec.log != nil {
+		rec.log.Entries = append(rec.log.Entries, entry)
+	}
+}
+
+// Transport records all requests, that go through next, while a capture is running
+func (rec *Recorder) Transport(target string, next http.RoundTripper, resolveServiceID ServiceIDResolver) http.RoundTripper {
+	return &recordingTransport{
+		rec:              rec,
+		target:           target,
+		next:             next,
+		resolveServiceID: resolveServiceID,
+	}
+}
+
+type recordingTransport struct {
+	rec              *Recorder
+	target           string
+	next             http.RoundTripper
+	resolveServiceID ServiceIDResolver
+}
+
+func (t *recordingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !t.rec.Recording() {
+		return t.next.RoundTrip(r)
+	}
+	start := time.Now()
+	entry := &Entry{
+		StartedDateTime: start.Format(time.RFC3339Nano),
+		Target:          t.target,
+		Request:         t.rec.request(r),
+	}
+	if t.resolveServiceID != nil {
+		entry.ServiceID = t.resolveServiceID(r)
+	}
+	var requestBody *limitedBuffer
+	contentType := r.Header.Get("Content-Type")
+	if r.Body != nil && r.Body != http.NoBody {
+		requestBody = newLimitedBuffer(t.rec.config.MaxBodySize)
+		r = r.Clone(r.Context())
+		// the transport may still be sending the body, when the response arrives, it is done, when it closes the body
+		r.Body = &teeReadCloser{
+			ReadCloser: r.Body,
+			buf:        requestBody,
+			onClose: func() {
+				t.rec.setPostData(entry, contentType, requestBody)
+			},
+		}
+	}
+	resp, errRoundTrip := t.next.RoundTrip(r)
+	wait := time.Since(start)
+	t.rec.setPostData(entry, contentType, requestBody)
+	if errRoundTrip != nil {
+		entry.Response = &Response{
+			HTTPVersion: r.Proto,
+			Cookies:     []*Cookie{},
+			Headers:     []*NameValue{},
+			Content:     &Content{MimeType: "x-unknown"},
+			HeadersSize: -1,
+			BodySize:    -1,
+			Comment:     errRoundTrip.Error(),
+		}
+		entry.Time = milliseconds(wait)
+		entry.Timings = &Timings{Wait: milliseconds(wait)}
+		t.rec.add(entry)
+		return resp, errRoundTrip
+	}
+	entry.Response = t.rec.response(resp)
+	responseBody := newLimitedBuffer(t.rec.config.MaxBodySize)
+	resp.Body = &teeReadCloser{
+		ReadCloser: resp.Body,
+		buf:        responseBody,
+		onClose: func() {
+			receive := time.Since(start) - wait
+			entry.Response.Content = t.rec.content(resp.Header.Get("Content-Type"), responseBody)
+			entry.Response.BodySize = entry.Response.Content.Size
+			entry.Time = milliseconds(wait + receive)
+			entry.Timings = &Timings{
+				Wait:    milliseconds(wait),
+				Receive: milliseconds(receive),
+			}
+			t.rec.add(entry)
+		},
+	}
+	return resp, nil
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func (rec *Recorder) headers(header http.Header) []*NameValue {
+	return nameValues(header, func(name string) bool {
+		return rec.redacts(http.CanonicalHeaderKey(name))
+	})
+}
+
+// nameValues sorted by name for stable HAR files
+func nameValues(values map[string][]string, redact func(name string) bool) []*NameValue {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	nvs := []*NameValue{}
+	for _, name := range names {
+		for _, value := range values[name] {
+			if redact != nil && redact(name) {
+				value = redacted
+			}
+			nvs = append(nvs, &NameValue{Name: name, Value: value})
+		}
+	}
+	return nvs
+}
+
+func (rec *Recorder) redacts(name string) bool {
+	_, ok := rec.redact[name]
+	return ok
+}
+
+func (rec *Recorder) request(r *http.Request) *Request {
+	cookies := []*Cookie{}
+	for _, c := range r.Cookies() {
+		value := c.Value
+		if rec.redacts("Cookie") {
+			value = redacted
+		}
+		cookies = append(cookies, &Cookie{Name: c.Name, Value: value})
+	}
+	return &Request{
+		Method:      r.Method,
+		URL:         r.URL.String(),
+		HTTPVersion: r.Proto,
+		Cookies:     cookies,
+		Headers:     rec.headers(r.Header),
+		QueryString: nameValues(r.URL.Query(), nil),
+		HeadersSize: -1,
+		BodySize:    0,
+	}
+}
+
+func (rec *Recorder) response(resp *http.Response) *Response {
+	cookies := []*Cookie{}
+	for _, c := range resp.Cookies() {
+		value := c.Value
+		if rec.redacts("Set-Cookie") {
+			value = redacted
+		}
+		cookie := &Cookie{
+			Name:     c.Name,
+			Value:    value,
+			Path:     c.Path,
+			Domain:   c.Domain,
+			HTTPOnly: c.HttpOnly,
+			Secure:   c.Secure,
+		}
+		if !c.Expires.IsZero() {
+			cookie.Expires = c.Expires.Format(time.RFC3339)
+		}
+		cookies = append(cookies, cookie)
+	}
+	statusText := strings.TrimSpace(strings.TrimPrefix(resp.Status, fmt.Sprint(resp.StatusCode)))
+	return &Response{
+		Status:      resp.StatusCode,
+		StatusText:  statusText,
+		HTTPVersion: resp.Proto,
+		Cookies:     cookies,
+		Headers:     rec.headers(resp.Header),
+		Content:     &Content{MimeType: resp.Header.Get("Content-Type")},
+		RedirectURL: resp.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+}
+
+func truncatedComment(body []byte, size int64) string {
+	if size > int64(len(body)) {
+		return fmt.Sprintf("body truncated to %d of %d bytes", len(body), size)
+	}
+	return ""
+}
+
+// setPostData of a request with what has been sent so far, the entry may already be in the log
+func (rec *Recorder) setPostData(entry *Entry, contentType string, buf *limitedBuffer) {
+	if buf == nil {
+		return
+	}
+	body, size := buf.snapshot()
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+	entry.Request.BodySize = size
+	entry.Request.PostData = &PostData{
+		MimeType: contentType,
+		Params:   []*NameValue{},
+		Text:     string(body),
+		Comment:  truncatedComment(body, size),
+	}
+}
+
+func (rec *Recorder) content(contentType string, buf *limitedBuffer) *Content {
+	body, size := buf.snapshot()
+	c := &Content{
+		Size:     size,
+		MimeType: contentType,
+		Comment:  truncatedComment(body, size),
+	}
+	if c.MimeType == "" {
+		c.MimeType = "x-unknown"
+	}
+	if isText(contentType, body) {
+		c.Text = string(body)
+	} else {
+		c.Text = base64.StdEncoding.EncodeToString(body)
+		c.Encoding = "base64"
+	}
+	return c
+}
+
+func isText(contentType string, body []byte) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "json"),
+		strings.HasSuffix(mediaType, "xml"),
+		strings.HasSuffix(mediaType, "javascript"),
+		mediaType == "application/x-www-form-urlencoded":
+		return true
+	case mediaType == "":
+		return utf8.Valid(body)
+	}
+	return false
+}
+
+// limitedBuffer keeps up to limit bytes, but counts everything, it is written and read from different goroutines
+type limitedBuffer struct {
+	lock  sync.Mutex
+	buf   bytes.Buffer
+	limit int64
+	size  int64
+}
+
+func newLimitedBuffer(limit int64) *limitedBuffer {
+	return &limitedBuffer{limit: limit}
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.size += int64(len(p))
+	if room := b.limit - int64(b.buf.Len()); room > 0 {
+		if int64(len(p)) > room {
+			b.buf.Write(p[:room])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// snapshot a copy of the kept bytes and the size of everything written so far
+func (b *limitedBuffer) snapshot() ([]byte, int64) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return bytes.Clone(b.buf.Bytes()), b.size
+}
+
+type teeReadCloser struct {
+	io.ReadCloser
+	buf     *limitedBuffer
+	once    sync.Once
+	onClose func()
+}
+
+func (t *teeReadCloser) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		_, _ = t.buf.Write(p[:n])
+	}
+	return n, err
+}
+
+func (t *teeReadCloser) Close() error {
+	errClose := t.ReadCloser.Close()
+	if t.onClose != nil {
+		t.once.Do(t.onClose)
+	}
+	return errClose
+}
@@ -0,0 +1,143 @@
+package har
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/foomo/webgrapple/pkg/vo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorder(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Set-Cookie", "session=secret")
+		fmt.Fprint(w, strings.Repeat("a", 100))
+	}))
+	defer upstream.Close()
+
+	rec := NewRecorder(Config{Dir: t.TempDir(), MaxBodySize: 10})
+	client := &http.Client{Transport: rec.Transport(TargetService, http.DefaultTransport, func(r *http.Request) vo.ServiceID {
+		return "my-service"
+	})}
+	get := func() {
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, upstream.URL+"/?q=1", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		_, _ = io.Copy(io.Discard, resp.Body)
+		require.NoError(t, resp.Body.Close())
+	}
+
+	get()
+	_, _, errNotRecording := rec.Stop()
+	require.ErrorIs(t, errNotRecording, ErrNotRecording)
+
+	rec.Start()
+	get()
+	file, entries, errStop := rec.Stop()
+	require.NoError(t, errStop)
+	assert.Equal(t, 1, entries)
+
+	harBytes, errRead := os.ReadFile(file)
+	require.NoError(t, errRead)
+	assert.NotContains(t, string(harBytes), "secret")
+	harFile := &File{}
+	require.NoError(t, json.Unmarshal(harBytes, harFile))
+	entry := harFile.Log.Entries[0]
+	assert.Equal(t, vo.ServiceID("my-service"), entry.ServiceID)
+	assert.Equal(t, "aaaaaaaaaa", entry.Response.Content.Text)
+	assert.Equal(t, int64(100), entry.Response.Content.Size)
+	assert.Equal(t, []*NameValue{{Name: "q", Value: "1"}}, entry.Request.QueryString)
+}
+
+func TestRecorderKeepsCapturesOfTheSameSecond(t *testing.T) {
+	dir := t.TempDir()
+	rec := NewRecorder(Config{Dir: dir})
+	files := map[string]bool{}
+	for range 3 {
+		rec.Start()
+		// same start time, as if within one millisecond
+		rec.lock.Lock()
+		rec.started = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+		rec.lock.Unlock()
+		file, _, errStop := rec.Stop()
+		require.NoError(t, errStop)
+		files[file] = true
+	}
+	assert.Len(t, files, 3)
+	entries, errRead := os.ReadDir(dir)
+	require.NoError(t, errRead)
+	assert.Len(t, entries, 3)
+}
+
+// slowBody sends one byte at a time
+type slowBody struct {
+	left int
+}
+
+func (b *slowBody) Read(p []byte) (int, error) {
+	if b.left == 0 {
+		return 0, io.EOF
+	}
+	time.Sleep(time.Millisecond)
+	b.left--
+	p[0] = 'b'
+	return 1, nil
+}
+
+func (b *slowBody) Close() error {
+	return nil
+}
+
+func TestRecorderRequestBodyOfEarlyResponses(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// respond, before the body was read
+		rc := http.NewResponseController(w)
+		assert.NoError(t, rc.EnableFullDuplex())
+		w.WriteHeader(http.StatusAccepted)
+		assert.NoError(t, rc.Flush())
+		_, _ = io.Copy(io.Discard, r.Body)
+	}))
+	defer upstream.Close()
+
+	rec := NewRecorder(Config{Dir: t.TempDir(), MaxBodySize: 10})
+	client := &http.Client{Transport: rec.Transport(TargetBackend, http.DefaultTransport, nil)}
+	rec.Start()
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, upstream.URL, &slowBody{left: 100})
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "text/plain")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	_, _ = io.Copy(io.Discard, resp.Body)
+	require.NoError(t, resp.Body.Close())
+
+	// the transport closes the request body, once it is sent
+	require.Eventually(t, func() bool {
+		rec.lock.Lock()
+		defer rec.lock.Unlock()
+		return len(rec.log.Entries) == 1 && rec.log.Entries[0].Request.BodySize == 100
+	}, time.Second, time.Millisecond)
+	file, _, errStop := rec.Stop()
+	require.NoError(t, errStop)
+
+	harBytes, errRead := os.ReadFile(file)
+	require.NoError(t, errRead)
+	harFile := &File{}
+	require.NoError(t, json.Unmarshal(harBytes, harFile))
+	require.Len(t, harFile.Log.Entries, 1)
+	postData := harFile.Log.Entries[0].Request.PostData
+	require.NotNil(t, postData)
+	assert.Equal(t, "text/plain", postData.MimeType)
+	assert.Equal(t, "bbbbbbbbbb", postData.Text)
+	assert.Equal(t, "body truncated to 10 of 100 bytes", postData.Comment)
+}
@@ -0,0 +1,267 @@
+package responsecache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// HeaderCache tells, where a response came from
+const HeaderCache = "X-Webgrapple-Cache"
+
+// DefaultMaxBodySize larger responses will not be recorded
+const DefaultMaxBodySize int64 = 32 * 1024 * 1024
+
+// DefaultKeyHeaders request headers, that are part of the cache key by default
+var DefaultKeyHeaders = []string{"Accept"}
+
+// cacheableStatus responses with these codes will be recorded
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusFound:                true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusGone:                 true,
+}
+
+// Config for a Cache
+type Config struct {
+	// Dir responses are stored in
+	Dir string
+	// KeyHeaders request headers, that are used together with method and url to identify a response
+	KeyHeaders []string
+	// MaxBodySize responses with larger bodies are not recorded
+	MaxBodySize int64
+	// Offline replay recorded responses, instead of talking to the backend
+	Offline bool
+	// Private also record responses with Cache-Control: private or Set-Cookie headers
+	Private bool
+}
+
+// Cache records backend responses to disk and replays them when offline
+type Cache struct {
+	config Config
+}
+
+type entry struct {
+	Method   string      `json:"method"`
+	URL      string      `json:"url"`
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header"`
+	Recorded time.Time   `json:"recorded"`
+}
+
+// New cache, the directory will be created if necessary
+func New(config Config) (*Cache, error) {
+	if config.Dir == "" {
+		return nil, errors.New("response cache dir must not be empty")
+	}
+	if config.KeyHeaders == nil {
+		config.KeyHeaders = DefaultKeyHeaders
+	}
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = DefaultMaxBodySize
+	}
+	if err := os.MkdirAll(config.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("could not create response cache dir: %w", err)
+	}
+	return &Cache{config: config}, nil
+}
+
+// DefaultDir in the users cache dir
+func DefaultDir() string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		cacheDir = os.TempDir()
+	}
+	return filepath.Join(cacheDir, "webgrapple", "responses")
+}
+
+func (c *Cache) key(r *http.Request) string {
+	h := sha256.New()
+	fmt.Fprintln(h, r.Method)
+	fmt.Fprintln(h, r.URL.String())
+	for _, name := range c.config.KeyHeaders {
+		fmt.Fprintln(h, http.CanonicalHeaderKey(name)+": "+strings.Join(r.Header.Values(name), ", "))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *Cache) files(key string) (entryFile, bodyFile string) {
+	base := filepath.Join(c.config.Dir, key[:2], key)
+	return base + ".json", base + ".body"
+}
+
+func cacheable(r *http.Request, resp *http.Response, private bool) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if !cacheableStatus[resp.StatusCode] {
+		return false
+	}
+	cacheControl := strings.ToLower(resp.Header.Get("Cache-Control"))
+	if strings.Contains(cacheControl, "no-store") {
+		return false
+	}
+	// user specific responses do not end up on disk unless asked for
+	return private || (!strings.Contains(cacheControl, "private") && len(resp.Header.Values("Set-Cookie")) == 0)
+}
+
+// Transport records responses from next, or replays them when offline
+func (c *Cache) Transport(next http.RoundTripper) http.RoundTripper {
+	return &cacheTransport{c: c, next: next}
+}
+
+type cacheTransport struct {
+	c    *Cache
+	next http.RoundTripper
+}
+
+func (t *cacheTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if t.c.config.Offline {
+		return t.c.replay(r)
+	}
+	resp, err := t.next.RoundTrip(r)
+	if err != nil || !cacheable(r, resp, t.c.config.Private) {
+		return resp, err
+	}
+	if resp.ContentLength > t.c.config.MaxBodySize {
+		return resp, nil
+	}
+	body, errRead := io.ReadAll(io.LimitReader(resp.Body, t.c.config.MaxBodySize+1))
+	if errRead != nil {
+		resp.Body.Close()
+		return nil, errRead
+	}
+	if int64(len(body)) > t.c.config.MaxBodySize {
+		// too big to keep, hand on what we have read and the rest
+		resp.Body = &multiReadCloser{Reader: io.MultiReader(bytes.NewReader(body), resp.Body), Closer: resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	// a failing write must not break browsing
+	_ = t.c.store(r, resp, body)
+	return resp, nil
+}
+
+type multiReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func writeFileAtomic(file string, data []byte) error {
+	tmp, errCreate := os.CreateTemp(filepath.Dir(file), ".tmp-*")
+	if errCreate != nil {
+		return errCreate
+	}
+	if _, errWrite := tmp.Write(data); errWrite != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return errWrite
+	}
+	if errClose := tmp.Close(); errClose != nil {
+		os.Remove(tmp.Name())
+		return errClose
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+func (c *Cache) store(r *http.Request, resp *http.Response, body []byte) error {
+	entryFile, bodyFile := c.files(c.key(r))
+	if err := os.MkdirAll(filepath.Dir(entryFile), 0o700); err != nil {
+		return err
+	}
+	entryBytes, errMarshal := json.Marshal(&entry{
+		Method:   r.Method,
+		URL:      r.URL.String(),
+		Status:   resp.StatusCode,
+		Header:   resp.Header,
+		Recorded: time.Now(),
+	})
+	if errMarshal != nil {
+		return errMarshal
+	}
+	if err := writeFileAtomic(bodyFile, body); err != nil {
+		return err
+	}
+	return writeFileAtomic(entryFile, entryBytes)
+}
+
+func (c *Cache) replay(r *http.Request) (*http.Response, error) {
+	entryFile, bodyFile := c.files(c.key(r))
+	entryBytes, errReadEntry := os.ReadFile(entryFile)
+	if errReadEntry != nil {
+		if errors.Is(errReadEntry, os.ErrNotExist) {
+			return notRecorded(r), nil
+		}
+		return nil, errReadEntry
+	}
+	e := &entry{}
+	if err := json.Unmarshal(entryBytes, e); err != nil {
+		return nil, fmt.Errorf("corrupt response cache entry %q: %w", entryFile, err)
+	}
+	body, errReadBody := os.ReadFile(bodyFile)
+	if errReadBody != nil {
+		return nil, errReadBody
+	}
+	header := e.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set(HeaderCache, "offline; recorded="+e.Recorded.Format(time.RFC3339))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status)),
+		StatusCode:    e.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       r,
+	}, nil
+}
+
+func notRecorded(r *http.Request) *http.Response {
+	page := `<!DOCTYPE html>
+<html>
+<head><title>webgrapple - not recorded</title></head>
+<body>
+<h1>not recorded</h1>
+<p>webgrapple is offline and there is no recorded backend response for</p>
+<pre>` + html.EscapeString(r.Method+" "+r.URL.String()) + `</pre>
+<p>run the reverse proxy with --cache while online and visit this page to record it.</p>
+</body>
+</html>
+`
+	header := http.Header{}
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	header.Set("Cache-Control", "no-store")
+	header.Set(HeaderCache, "miss")
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", http.StatusGatewayTimeout, http.StatusText(http.StatusGatewayTimeout)),
+		StatusCode:    http.StatusGatewayTimeout,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(page)),
+		ContentLength: int64(len(page)),
+		Request:       r,
+	}
+}
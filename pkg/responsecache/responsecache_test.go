@@ -0,0 +1,128 @@
+package responsecache
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBackend(t *testing.T) (*httptest.Server, *int) {
+	t.Helper()
+	requests := 0
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store")
+		case "/private":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		case "/cookie":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s3cret"})
+		case "/big":
+			fmt.Fprint(w, strings.Repeat("x", 100))
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, r.Method+" "+r.URL.Path)
+	}))
+	t.Cleanup(backend.Close)
+	return backend, &requests
+}
+
+func do(t *testing.T, transport http.RoundTripper, method, url string) (*http.Response, string) {
+	t.Helper()
+	req, errRequest := http.NewRequestWithContext(t.Context(), method, url, nil)
+	require.NoError(t, errRequest)
+	resp, errDo := transport.RoundTrip(req)
+	require.NoError(t, errDo)
+	defer resp.Body.Close()
+	body, errRead := io.ReadAll(resp.Body)
+	require.NoError(t, errRead)
+	return resp, string(body)
+}
+
+func TestCache(t *testing.T) {
+	backend, requests := newBackend(t)
+	dir := t.TempDir()
+	online, errOnline := New(Config{Dir: dir, MaxBodySize: 50})
+	require.NoError(t, errOnline)
+	offline, errOffline := New(Config{Dir: dir, MaxBodySize: 50, Offline: true})
+	require.NoError(t, errOffline)
+	record := online.Transport(http.DefaultTransport)
+	replay := offline.Transport(http.DefaultTransport)
+
+	for _, path := range []string{"/page", "/no-store", "/private", "/cookie", "/big"} {
+		_, body := do(t, record, http.MethodGet, backend.URL+path)
+		assert.NotEmpty(t, body, path)
+	}
+	do(t, record, http.MethodPost, backend.URL+"/post")
+	assert.Equal(t, 6, *requests)
+
+	resp, body := do(t, replay, http.MethodGet, backend.URL+"/page")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "GET /page", body)
+	assert.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(resp.Header.Get(HeaderCache), "offline; recorded="))
+
+	for _, test := range []struct {
+		name   string
+		method string
+		path   string
+	}{
+		{name: "no-store", method: http.MethodGet, path: "/no-store"},
+		{name: "private", method: http.MethodGet, path: "/private"},
+		{name: "set cookie", method: http.MethodGet, path: "/cookie"},
+		{name: "too big", method: http.MethodGet, path: "/big"},
+		{name: "post", method: http.MethodPost, path: "/post"},
+		{name: "never visited", method: http.MethodGet, path: "/unknown"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			resp, body := do(t, replay, test.method, backend.URL+test.path)
+			assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+			assert.Equal(t, "miss", resp.Header.Get(HeaderCache))
+			assert.Contains(t, body, "not recorded")
+			assert.Contains(t, body, test.method+" "+backend.URL+test.path)
+		})
+	}
+	// offline never talks to the backend
+	assert.Equal(t, 6, *requests)
+}
+
+func TestCachePrivate(t *testing.T) {
+	backend, _ := newBackend(t)
+	dir := t.TempDir()
+	online, errOnline := New(Config{Dir: dir, Private: true})
+	require.NoError(t, errOnline)
+	offline, errOffline := New(Config{Dir: dir, Offline: true})
+	require.NoError(t, errOffline)
+	for _, path := range []string{"/private", "/cookie"} {
+		do(t, online.Transport(http.DefaultTransport), http.MethodGet, backend.URL+path)
+		resp, body := do(t, offline.Transport(http.DefaultTransport), http.MethodGet, backend.URL+path)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, path)
+		assert.Equal(t, "GET "+path, body)
+	}
+}
+
+func TestCacheKeyHeaders(t *testing.T) {
+	backend, _ := newBackend(t)
+	dir := t.TempDir()
+	online, errOnline := New(Config{Dir: dir})
+	require.NoError(t, errOnline)
+	offline, errOffline := New(Config{Dir: dir, Offline: true})
+	require.NoError(t, errOffline)
+	do(t, online.Transport(http.DefaultTransport), http.MethodGet, backend.URL+"/page")
+
+	req, errRequest := http.NewRequestWithContext(t.Context(), http.MethodGet, backend.URL+"/page", nil)
+	require.NoError(t, errRequest)
+	req.Header.Set("Accept", "application/json")
+	resp, errDo := offline.Transport(http.DefaultTransport).RoundTrip(req)
+	require.NoError(t, errDo)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+}
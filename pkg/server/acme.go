@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/foomo/webgrapple/pkg/certs"
+	"github.com/foomo/webgrapple/pkg/log"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ACMEConfig get certificates from an ACME CA like step-ca or Let's Encrypt instead of the local CA,
+// challenges are answered with HTTP-01 on the proxies http listeners and TLS-ALPN-01 on its https listeners
+type ACMEConfig struct {
+	// DirectoryURL of the ACME server, defaults to Let's Encrypt
+	DirectoryURL string
+	// Email contact for the account
+	Email string
+	// CacheDir where account keys and certificates are kept, defaults to webgrapple/acme in the users state dir
+	CacheDir string
+	// DirectoryCAFile PEM file with an additional root to trust, when talking to the ACME server
+	DirectoryCAFile string
+	// RenewBefore how long before expiry certificates are renewed, autocert defaults to 30 days
+	RenewBefore time.Duration
+}
+
+func newACMEManager(l log.Logger, config ACMEConfig, hosts, sniAllow []string) (*autocert.Manager, error) {
+	cacheDir := config.CacheDir
+	if cacheDir == "" {
+		stateDir, errStateDir := certs.DefaultStateDir()
+		if errStateDir != nil {
+			return nil, errStateDir
+		}
+		cacheDir = filepath.Join(filepath.Dir(stateDir), "acme")
+	}
+	if errDir := certs.EnsurePrivateDir(cacheDir); errDir != nil {
+		return nil, errDir
+	}
+	httpClient, errClient := acmeHTTPClient(config.DirectoryCAFile)
+	if errClient != nil {
+		return nil, errClient
+	}
+	directoryURL := config.DirectoryURL
+	if directoryURL == "" {
+		directoryURL = autocert.DefaultACMEDirectory
+	}
+	policy, errPolicy := acmeHostPolicy(hosts, sniAllow)
+	if errPolicy != nil {
+		return nil, errPolicy
+	}
+	l.Info(fmt.Sprintf("getting certificates from ACME directory %q, caching them in %q", directoryURL, cacheDir))
+	return &autocert.Manager{
+		Prompt:      autocert.AcceptTOS,
+		Cache:       autocert.DirCache(cacheDir),
+		HostPolicy:  policy,
+		Email:       config.Email,
+		RenewBefore: config.RenewBefore,
+		Client: &acme.Client{
+			DirectoryURL: directoryURL,
+			HTTPClient:   httpClient,
+		},
+	}, nil
+}
+
+func acmeHTTPClient(caFile string) (*http.Client, error) {
+	if caFile == "" {
+		return http.DefaultClient, nil
+	}
+	caPEM, errRead := os.ReadFile(caFile)
+	if errRead != nil {
+		return nil, fmt.Errorf("could not read ACME directory CA: %w", errRead)
+	}
+	roots, errRoots := x509.SystemCertPool()
+	if errRoots != nil {
+		roots = x509.NewCertPool()
+	}
+	if !roots.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in ACME directory CA %q", caFile)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+	return &http.Client{Transport: transport}, nil
+}
+
+// acmeHostPolicy allow the proxies host names and names matching the sni allow patterns,
+// localhost and ip addresses can not be validated by an ACME server
+func acmeHostPolicy(hosts, sniAllow []string) (autocert.HostPolicy, error) {
+	allowed := map[string]bool{}
+	for _, host := range hosts {
+		if host == "localhost" || net.ParseIP(host) != nil {
+			continue
+		}
+		allowed[strings.ToLower(host)] = true
+	}
+	for _, pattern := range sniAllow {
+		if _, errPattern := path.Match(pattern, ""); errPattern != nil {
+			return nil, fmt.Errorf("invalid sni allow pattern %q: %w", pattern, errPattern)
+		}
+	}
+	if len(allowed) == 0 && len(sniAllow) == 0 {
+		return nil, errors.New("ACME needs at least one host name, that is not localhost or an ip address")
+	}
+	return func(_ context.Context, host string) error {
+		host = strings.ToLower(host)
+		if allowed[host] {
+			return nil
+		}
+		for _, pattern := range sniAllow {
+			if matched, _ := path.Match(strings.ToLower(pattern), host); matched {
+				return nil
+			}
+		}
+		return fmt.Errorf("acme: host %q not configured", host)
+	}, nil
+}
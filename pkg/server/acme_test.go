@@ -0,0 +1,288 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/foomo/webgrapple/pkg/certs"
+	"github.com/foomo/webgrapple/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestACMEHostPolicy(t *testing.T) {
+	_, errEmpty := acmeHostPolicy([]string{"localhost", "127.0.0.1"}, nil)
+	assert.Error(t, errEmpty)
+
+	policy, errPolicy := acmeHostPolicy([]string{"localhost", "proxy.example.com"}, []string{"*.dev.example.com"})
+	require.NoError(t, errPolicy)
+	ctx := context.Background()
+	assert.NoError(t, policy(ctx, "proxy.example.com"))
+	assert.NoError(t, policy(ctx, "Shop.dev.example.com"))
+	assert.Error(t, policy(ctx, "localhost"))
+	assert.Error(t, policy(ctx, "other.example.com"))
+}
+
+// fakeACME a minimal RFC 8555 directory, that validates http-01 challenges against the proxies http listener
+type fakeACME struct {
+	t          *testing.T
+	ca         *certs.CA
+	httpTarget string
+	server     *httptest.Server
+
+	lock       sync.Mutex
+	thumbprint string
+	domain     string
+	validated  bool
+	failed     bool
+	issued     []byte
+}
+
+func newFakeACME(t *testing.T, httpTarget string) *fakeACME {
+	t.Helper()
+	ca, _, errCA := certs.LoadOrCreateCA(filepath.Join(t.TempDir(), "ca"))
+	require.NoError(t, errCA)
+	f := &fakeACME{t: t, ca: ca, httpTarget: httpTarget}
+	f.server = httptest.NewTLSServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeACME) reply(w http.ResponseWriter, status int, location string, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if location != "" {
+		w.Header().Set("Location", f.server.URL+location)
+	}
+	w.WriteHeader(status)
+	assert.NoError(f.t, json.NewEncoder(w).Encode(v))
+}
+
+func (f *fakeACME) problem(w http.ResponseWriter, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(http.StatusForbidden)
+	fmt.Fprintf(w, `{"type":"urn:ietf:params:acme:error:unauthorized","detail":%q}`, detail)
+}
+
+func (f *fakeACME) order() map[string]interface{} {
+	order := map[string]interface{}{
+		"status":         "pending",
+		"identifiers":    []map[string]string{{"type": "dns", "value": f.domain}},
+		"authorizations": []string{f.server.URL + "/authz/1"},
+		"finalize":       f.server.URL + "/finalize/1",
+	}
+	switch {
+	case f.issued != nil:
+		order["status"] = "valid"
+		order["certificate"] = f.server.URL + "/cert/1"
+	case f.validated:
+		order["status"] = "ready"
+	}
+	return order
+}
+
+func (f *fakeACME) challenge() map[string]string {
+	status := "pending"
+	if f.validated {
+		status = "valid"
+	}
+	return map[string]string{"type": "http-01", "url": f.server.URL + "/challenge/1", "token": "t0ken", "status": status}
+}
+
+func (f *fakeACME) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", time.Now().UnixNano()))
+	if r.URL.Path == "/directory" {
+		f.reply(w, http.StatusOK, "", map[string]string{
+			"newNonce":   f.server.URL + "/nonce",
+			"newAccount": f.server.URL + "/account",
+			"newOrder":   f.server.URL + "/order",
+			"revokeCert": f.server.URL + "/revoke",
+			"keyChange":  f.server.URL + "/key-change",
+		})
+		return
+	}
+	if r.URL.Path == "/nonce" {
+		return
+	}
+	var jws struct {
+		Protected string `json:"protected"`
+		Payload   string `json:"payload"`
+	}
+	require.NoError(f.t, json.NewDecoder(r.Body).Decode(&jws))
+	protectedBytes, errProtected := base64.RawURLEncoding.DecodeString(jws.Protected)
+	require.NoError(f.t, errProtected)
+	payload, errPayload := base64.RawURLEncoding.DecodeString(jws.Payload)
+	require.NoError(f.t, errPayload)
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	switch r.URL.Path {
+	case "/account":
+		var protected struct {
+			JWK struct {
+				Crv string `json:"crv"`
+				X   string `json:"x"`
+				Y   string `json:"y"`
+			} `json:"jwk"`
+		}
+		require.NoError(f.t, json.Unmarshal(protectedBytes, &protected))
+		// RFC 7638 thumbprint of an EC key
+		sum := sha256.Sum256(fmt.Appendf(nil, `{"crv":%q,"kty":"EC","x":%q,"y":%q}`, protected.JWK.Crv, protected.JWK.X, protected.JWK.Y))
+		f.thumbprint = base64.RawURLEncoding.EncodeToString(sum[:])
+		f.reply(w, http.StatusCreated, "/account/1", map[string]string{"status": "valid"})
+	case "/order":
+		if f.failed {
+			f.problem(w, "validation failed before")
+			return
+		}
+		var newOrder struct {
+			Identifiers []struct{ Value string } `json:"identifiers"`
+		}
+		require.NoError(f.t, json.Unmarshal(payload, &newOrder))
+		f.domain = newOrder.Identifiers[0].Value
+		f.reply(w, http.StatusCreated, "/order/1", f.order())
+	case "/order/1":
+		f.reply(w, http.StatusOK, "/order/1", f.order())
+	case "/authz/1":
+		status := "pending"
+		if f.validated {
+			status = "valid"
+		}
+		f.reply(w, http.StatusOK, "", map[string]interface{}{
+			"status":     status,
+			"identifier": map[string]string{"type": "dns", "value": f.domain},
+			"challenges": []map[string]string{f.challenge()},
+		})
+	case "/challenge/1":
+		// validate, like a real CA would, on the http listener of the domain
+		req, errRequest := http.NewRequestWithContext(r.Context(), http.MethodGet, f.httpTarget+"/.well-known/acme-challenge/t0ken", nil)
+		require.NoError(f.t, errRequest)
+		req.Host = f.domain
+		resp, errDo := http.DefaultClient.Do(req)
+		require.NoError(f.t, errDo)
+		defer resp.Body.Close()
+		keyAuth, errRead := io.ReadAll(resp.Body)
+		require.NoError(f.t, errRead)
+		if resp.StatusCode != http.StatusOK || string(keyAuth) != "t0ken."+f.thumbprint {
+			f.failed = true
+			f.problem(w, fmt.Sprintf("unexpected key authorization %d %q", resp.StatusCode, keyAuth))
+			return
+		}
+		f.validated = true
+		f.reply(w, http.StatusOK, "", f.challenge())
+	case "/finalize/1":
+		var finalize struct {
+			CSR string `json:"csr"`
+		}
+		require.NoError(f.t, json.Unmarshal(payload, &finalize))
+		csrBytes, errCSR := base64.RawURLEncoding.DecodeString(finalize.CSR)
+		require.NoError(f.t, errCSR)
+		csr, errParse := x509.ParseCertificateRequest(csrBytes)
+		require.NoError(f.t, errParse)
+		notBefore := time.Now().Add(-time.Hour)
+		der, errCreate := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(notBefore.UnixNano()),
+			Subject:      pkix.Name{CommonName: f.domain},
+			DNSNames:     csr.DNSNames,
+			NotBefore:    notBefore,
+			NotAfter:     notBefore.Add(90 * 24 * time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}, f.ca.Cert, csr.PublicKey, f.ca.Key)
+		require.NoError(f.t, errCreate)
+		f.issued = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		f.reply(w, http.StatusOK, "/order/1", f.order())
+	case "/cert/1":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		_, _ = w.Write(f.issued)
+	default:
+		f.problem(w, "unexpected "+r.URL.Path)
+	}
+}
+
+func TestACMEIssueHTTP01(t *testing.T) {
+	l := utils.GetLogger().Sugar()
+	// the proxies http listener, the manager is only known after the acme server is running
+	var httpHandler http.Handler
+	proxyHTTP := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httpHandler.ServeHTTP(w, r)
+	}))
+	defer proxyHTTP.Close()
+	fake := newFakeACME(t, proxyHTTP.URL)
+	directoryCAFile := filepath.Join(t.TempDir(), "directory-ca.pem")
+	require.NoError(t, os.WriteFile(directoryCAFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: fake.server.Certificate().Raw}), 0o600))
+
+	manager, errManager := newACMEManager(l, ACMEConfig{
+		DirectoryURL:    fake.server.URL + "/directory",
+		Email:           "dev@example.com",
+		CacheDir:        filepath.Join(t.TempDir(), "acme"),
+		DirectoryCAFile: directoryCAFile,
+	}, []string{"localhost", "shop.example.com"}, nil)
+	require.NoError(t, errManager)
+	httpHandler = manager.HTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "proxied")
+	}))
+
+	cert, errCert := manager.GetCertificate(&tls.ClientHelloInfo{ServerName: "shop.example.com"})
+	require.NoError(t, errCert)
+	require.NotNil(t, cert.Leaf)
+	assert.Equal(t, []string{"shop.example.com"}, cert.Leaf.DNSNames)
+	assert.True(t, fake.ca.Signed(cert.Leaf))
+	fake.lock.Lock()
+	assert.True(t, fake.validated, "http-01 challenge was not validated")
+	fake.lock.Unlock()
+
+	// everything, that is not a challenge, reaches the proxy
+	resp, errGet := http.Get(proxyHTTP.URL + "/some/page")
+	require.NoError(t, errGet)
+	defer resp.Body.Close()
+	body, errRead := io.ReadAll(resp.Body)
+	require.NoError(t, errRead)
+	assert.Equal(t, "proxied", string(body))
+
+	_, errNotAllowed := manager.GetCertificate(&tls.ClientHelloInfo{ServerName: "other.example.com"})
+	assert.ErrorContains(t, errNotAllowed, "not configured")
+}
+
+func TestACMEHTTPClient(t *testing.T) {
+	directory := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "{}")
+	}))
+	defer directory.Close()
+	dir := t.TempDir()
+
+	defaultClient, errDefault := acmeHTTPClient("")
+	require.NoError(t, errDefault)
+	_, errGet := defaultClient.Get(directory.URL)
+	assert.ErrorContains(t, errGet, "certificate")
+
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: directory.Certificate().Raw}), 0o600))
+	client, errClient := acmeHTTPClient(caFile)
+	require.NoError(t, errClient)
+	resp, errTrusted := client.Get(directory.URL)
+	require.NoError(t, errTrusted)
+	resp.Body.Close()
+
+	_, errMissing := acmeHTTPClient(filepath.Join(dir, "missing.pem"))
+	assert.ErrorContains(t, errMissing, "could not read ACME directory CA")
+	emptyFile := filepath.Join(dir, "empty.pem")
+	require.NoError(t, os.WriteFile(emptyFile, []byte("nothing"), 0o600))
+	_, errEmpty := acmeHTTPClient(emptyFile)
+	assert.ErrorContains(t, errEmpty, "no certificates found")
+}
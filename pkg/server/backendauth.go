@@ -0,0 +1,200 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	secretPrefixEnv  = "env:"
+	secretPrefixFile = "file:"
+	// refresh oauth2 tokens a little before they actually expire
+	tokenRefreshMargin = 30 * time.Second
+)
+
+// BackendAuth credentials, that will be injected into requests to the fallback backend only,
+// secrets are references like env:NAME or file:/path/to/secret
+type BackendAuth struct {
+	BasicUser     string
+	BasicPassword string
+	// Headers static headers, values may be secret references
+	Headers map[string]string
+	OAuth2  *OAuth2ClientCredentials
+}
+
+// OAuth2ClientCredentials fetch bearer tokens with the client credentials grant
+type OAuth2ClientCredentials struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+func (a *BackendAuth) empty() bool {
+	return a == nil || (a.BasicUser == "" && len(a.Headers) == 0 && a.OAuth2 == nil)
+}
+
+func resolveSecret(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, secretPrefixEnv):
+		name := strings.TrimPrefix(ref, secretPrefixEnv)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("secret env var %q is not set", name)
+		}
+		return value, nil
+	case strings.HasPrefix(ref, secretPrefixFile):
+		secretBytes, errRead := os.ReadFile(strings.TrimPrefix(ref, secretPrefixFile))
+		if errRead != nil {
+			return "", fmt.Errorf("could not read secret file: %w", errRead)
+		}
+		return strings.TrimRight(string(secretBytes), "\r\n"), nil
+	default:
+		return "", errors.New("secrets have to be given as " + secretPrefixEnv + "NAME or " + secretPrefixFile + "PATH")
+	}
+}
+
+// resolveHeaderValue header values may be secrets, but do not have to be
+func resolveHeaderValue(value string) (string, error) {
+	if strings.HasPrefix(value, secretPrefixEnv) || strings.HasPrefix(value, secretPrefixFile) {
+		return resolveSecret(value)
+	}
+	return value, nil
+}
+
+type authTransport struct {
+	next          http.RoundTripper
+	basicUser     string
+	basicPassword string
+	headers       http.Header
+	tokens        *tokenSource
+}
+
+// newAuthTransport inject the credentials into requests sent with next, tokens are fetched through proxy
+// with a transport, that verifies certificates, unlike the one for the backend
+func newAuthTransport(auth *BackendAuth, next http.RoundTripper, proxy proxyFunc) (http.RoundTripper, error) {
+	if auth.empty() {
+		return next, nil
+	}
+	t := &authTransport{
+		next:    next,
+		headers: http.Header{},
+	}
+	if auth.BasicUser != "" {
+		password, errPassword := resolveSecret(auth.BasicPassword)
+		if errPassword != nil {
+			return nil, fmt.Errorf("backend basic auth password: %w", errPassword)
+		}
+		t.basicUser = auth.BasicUser
+		t.basicPassword = password
+	}
+	for name, value := range auth.Headers {
+		resolvedValue, errValue := resolveHeaderValue(value)
+		if errValue != nil {
+			return nil, fmt.Errorf("backend header %q: %w", name, errValue)
+		}
+		t.headers.Set(name, resolvedValue)
+	}
+	if auth.OAuth2 != nil {
+		if auth.OAuth2.TokenURL == "" || auth.OAuth2.ClientID == "" {
+			return nil, errors.New("backend oauth2 needs a token url and a client id")
+		}
+		clientSecret, errClientSecret := resolveSecret(auth.OAuth2.ClientSecret)
+		if errClientSecret != nil {
+			return nil, fmt.Errorf("backend oauth2 client secret: %w", errClientSecret)
+		}
+		t.tokens = &tokenSource{
+			client:       &http.Client{Transport: newVerifyingTransport(proxy)},
+			tokenURL:     auth.OAuth2.TokenURL,
+			clientID:     auth.OAuth2.ClientID,
+			clientSecret: clientSecret,
+			scopes:       auth.OAuth2.Scopes,
+		}
+	}
+	return t, nil
+}
+
+func (t *authTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	if t.basicUser != "" {
+		r.SetBasicAuth(t.basicUser, t.basicPassword)
+	}
+	for name, values := range t.headers {
+		r.Header[name] = values
+	}
+	if t.tokens != nil {
+		token, errToken := t.tokens.token(r.Context())
+		if errToken != nil {
+			return nil, fmt.Errorf("could not get backend oauth2 token: %w", errToken)
+		}
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return t.next.RoundTrip(r)
+}
+
+type tokenSource struct {
+	client       *http.Client
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	scopes       []string
+
+	lock        sync.Mutex
+	accessToken string
+	expiry      time.Time
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func (ts *tokenSource) token(ctx context.Context) (string, error) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	if ts.accessToken != "" && (ts.expiry.IsZero() || time.Now().Before(ts.expiry.Add(-tokenRefreshMargin))) {
+		return ts.accessToken, nil
+	}
+	form := url.Values{
+		"grant_type": {"client_credentials"},
+	}
+	if len(ts.scopes) > 0 {
+		form.Set("scope", strings.Join(ts.scopes, " "))
+	}
+	req, errRequest := http.NewRequestWithContext(ctx, http.MethodPost, ts.tokenURL, strings.NewReader(form.Encode()))
+	if errRequest != nil {
+		return "", errRequest
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(ts.clientID), url.QueryEscape(ts.clientSecret))
+	resp, errDo := ts.client.Do(req)
+	if errDo != nil {
+		return "", errDo
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint responded with %q", resp.Status)
+	}
+	tr := &tokenResponse{}
+	if errDecode := json.NewDecoder(resp.Body).Decode(tr); errDecode != nil {
+		return "", fmt.Errorf("could not decode token response: %w", errDecode)
+	}
+	if tr.AccessToken == "" {
+		return "", errors.New("token response did not contain an access token")
+	}
+	ts.accessToken = tr.AccessToken
+	ts.expiry = time.Time{}
+	if tr.ExpiresIn > 0 {
+		ts.expiry = time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)
+	}
+	return ts.accessToken, nil
+}
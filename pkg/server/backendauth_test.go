@@ -0,0 +1,88 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthTransport(t *testing.T) {
+	t.Setenv("TEST_CLIENT_SECRET", "s3cret")
+	tokenRequests := 0
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests++
+		clientID, clientSecret, _ := r.BasicAuth()
+		assert.Equal(t, "webgrapple", clientID)
+		assert.Equal(t, "s3cret", clientSecret)
+		assert.Equal(t, "client_credentials", r.FormValue("grant_type"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":3600}`, tokenRequests)
+	}))
+	defer tokenServer.Close()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Header.Get("Authorization")+"|"+r.Header.Get("X-Api-Key"))
+	}))
+	defer backend.Close()
+
+	transport, errTransport := newAuthTransport(&BackendAuth{
+		Headers: map[string]string{"X-Api-Key": "env:TEST_CLIENT_SECRET"},
+		OAuth2: &OAuth2ClientCredentials{
+			TokenURL:     tokenServer.URL,
+			ClientID:     "webgrapple",
+			ClientSecret: "env:TEST_CLIENT_SECRET",
+		},
+	}, http.DefaultTransport, nil)
+	require.NoError(t, errTransport)
+	client := &http.Client{Transport: transport}
+
+	get := func() string {
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, backend.URL, nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+	assert.Equal(t, "Bearer token-1|s3cret", get())
+	assert.Equal(t, "Bearer token-1|s3cret", get())
+	assert.Equal(t, 1, tokenRequests)
+
+	_, errLiteralSecret := newAuthTransport(&BackendAuth{BasicUser: "user", BasicPassword: "plain"}, http.DefaultTransport, nil)
+	require.Error(t, errLiteralSecret)
+}
+
+func TestAuthTransportVerifiesTokenEndpoint(t *testing.T) {
+	t.Setenv("TEST_CLIENT_SECRET", "s3cret")
+	secretSent := false
+	// self signed
+	tokenServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secretSent = true
+		fmt.Fprint(w, `{"access_token":"token"}`)
+	}))
+	defer tokenServer.Close()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	transport, errTransport := newAuthTransport(&BackendAuth{
+		OAuth2: &OAuth2ClientCredentials{
+			TokenURL:     tokenServer.URL,
+			ClientID:     "webgrapple",
+			ClientSecret: "env:TEST_CLIENT_SECRET",
+		},
+	}, newTransport(nil), nil)
+	require.NoError(t, errTransport)
+	req, errRequest := http.NewRequestWithContext(t.Context(), http.MethodGet, backend.URL, nil)
+	require.NoError(t, errRequest)
+	_, errDo := (&http.Client{Transport: transport}).Do(req)
+	require.Error(t, errDo)
+	assert.ErrorContains(t, errDo, "certificate")
+	assert.False(t, secretSent)
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/foomo/webgrapple/pkg/certs"
+	"github.com/foomo/webgrapple/pkg/log"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// renewCheckInterval how often certificates are checked for renewal
+	renewCheckInterval = time.Hour
+	// maxIssued on demand certificates kept in memory
+	maxIssued = 256
+)
+
+// certManager serves the configured certificate and issues certificates for
+// allowed SNI names on demand while handshaking, certificates are renewed and hot swapped
+type certManager struct {
+	l        log.Logger
+	ca       *certs.CA
+	leaf     certs.LeafConfig
+	allow    []string
+	certFile string
+	keyFile  string
+	// managed the static certificate lives in the cert dir and can be reissued, otherwise it is only reloaded
+	managed bool
+	hosts   []string
+	// maxIssued when reached, the certificate expiring first is dropped
+	maxIssued int
+	issuing   singleflight.Group
+
+	lock         sync.Mutex
+	static       *tls.Certificate
+	staticLoaded time.Time
+	issued       map[string]*tls.Certificate
+}
+
+func newCertManager(l log.Logger, ca *certs.CA, leafConfig certs.LeafConfig, certFile, keyFile string, managed bool, hosts, allow []string) (*certManager, error) {
+	for _, pattern := range allow {
+		if _, errPattern := path.Match(pattern, ""); errPattern != nil {
+			return nil, fmt.Errorf("invalid sni allow pattern %q: %w", pattern, errPattern)
+		}
+	}
+	m := &certManager{
+		l:         l,
+		ca:        ca,
+		leaf:      leafConfig,
+		allow:     allow,
+		certFile:  certFile,
+		keyFile:   keyFile,
+		managed:   managed,
+		hosts:     hosts,
+		maxIssued: maxIssued,
+		issued:    map[string]*tls.Certificate{},
+	}
+	if errLoad := m.loadStatic(); errLoad != nil {
+		return nil, errLoad
+	}
+	return m, nil
+}
+
+func (m *certManager) loadStatic() error {
+	loaded := time.Now()
+	static, errLoad := tls.LoadX509KeyPair(m.certFile, m.keyFile)
+	if errLoad != nil {
+		return fmt.Errorf("could not load cert and key: %w", errLoad)
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.static = &static
+	m.staticLoaded = loaded
+	return nil
+}
+
+// allowed tells if a certificate may be issued for name, patterns are globs like *.test
+func (m *certManager) allowed(name string) bool {
+	for _, pattern := range m.allow {
+		if matched, _ := path.Match(strings.ToLower(pattern), name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *certManager) tlsConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: m.GetCertificate,
+	}
+}
+
+// GetCertificate use as tls.Config.GetCertificate
+func (m *certManager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+	m.lock.Lock()
+	static := m.static
+	cert, ok := m.issued[name]
+	m.lock.Unlock()
+	if name == "" || static.Leaf.VerifyHostname(name) == nil || !m.allowed(name) {
+		return static, nil
+	}
+	if ok {
+		return cert, nil
+	}
+	// issue outside of the lock, concurrent handshakes for the same name share one certificate
+	issued, errIssue, _ := m.issuing.Do(name, func() (interface{}, error) {
+		return m.issue(name)
+	})
+	if errIssue != nil {
+		return nil, errIssue
+	}
+	return issued.(*tls.Certificate), nil
+}
+
+func (m *certManager) issue(name string) (*tls.Certificate, error) {
+	m.l.Info(fmt.Sprintf("issuing certificate for sni name %q", name))
+	certPEM, keyPEM, errIssue := m.ca.Issue([]string{name}, m.leaf)
+	if errIssue != nil {
+		return nil, fmt.Errorf("could not issue certificate for %q: %w", name, errIssue)
+	}
+	cert, errKeyPair := tls.X509KeyPair(certPEM, keyPEM)
+	if errKeyPair != nil {
+		return nil, errKeyPair
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if len(m.issued) >= m.maxIssued {
+		m.dropFirstExpiring()
+	}
+	m.issued[name] = &cert
+	return &cert, nil
+}
+
+// dropFirstExpiring make room in the issued certificates, the lock must be held
+func (m *certManager) dropFirstExpiring() {
+	first := ""
+	for name, cert := range m.issued {
+		if first == "" || cert.Leaf.NotAfter.Before(m.issued[first].Leaf.NotAfter) {
+			first = name
+		}
+	}
+	delete(m.issued, first)
+}
+
+// renew check certificates until the context is done
+func (m *certManager) renew(ctx context.Context) {
+	ticker := time.NewTicker(renewCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.renewStatic()
+			m.expireIssued()
+		}
+	}
+}
+
+// renewStatic reissue our own certificate, when it is about to expire, or reload
+// a certificate brought by the user, when its file has changed
+func (m *certManager) renewStatic() {
+	m.lock.Lock()
+	leaf := m.static.Leaf
+	loaded := m.staticLoaded
+	m.lock.Unlock()
+	now := time.Now()
+	if m.managed {
+		if !certs.NeedsRenewal(leaf, now) {
+			return
+		}
+		if errIssue := issueCertAndKey(m.l, m.ca, m.leaf, m.hosts, m.certFile, m.keyFile); errIssue != nil {
+			m.l.Error(fmt.Sprintf("could not renew certificate: %v", errIssue))
+			return
+		}
+	} else {
+		info, errStat := os.Stat(m.certFile)
+		if errStat != nil || !info.ModTime().After(loaded) {
+			if certs.NeedsRenewal(leaf, now) {
+				m.l.Error(fmt.Sprintf("certificate %q expires at %s, please replace it", m.certFile, leaf.NotAfter))
+			}
+			return
+		}
+	}
+	if errLoad := m.loadStatic(); errLoad != nil {
+		m.l.Error(fmt.Sprintf("could not reload certificate: %v", errLoad))
+		return
+	}
+	m.l.Info(fmt.Sprintf("swapped in renewed certificate %q", m.certFile))
+}
+
+// expireIssued forget on demand certificates, that are about to expire, they will be reissued on the next handshake
+func (m *certManager) expireIssued() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := time.Now()
+	for name, cert := range m.issued {
+		if certs.NeedsRenewal(cert.Leaf, now) {
+			delete(m.issued, name)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/foomo/webgrapple/pkg/certs"
+	"github.com/foomo/webgrapple/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCertManager(t *testing.T) *certManager {
+	t.Helper()
+	l := utils.GetLogger().Sugar()
+	dir := t.TempDir()
+	ca, _, errCA := certs.LoadOrCreateCA(filepath.Join(dir, "ca"))
+	require.NoError(t, errCA)
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	require.NoError(t, issueCertAndKey(l, ca, certs.LeafConfig{}, []string{"localhost"}, certFile, keyFile))
+	m, errManager := newCertManager(l, ca, certs.LeafConfig{}, certFile, keyFile, true, []string{"localhost"}, []string{"*.test"})
+	require.NoError(t, errManager)
+	return m
+}
+
+func TestCertManagerGetCertificate(t *testing.T) {
+	m := newTestCertManager(t)
+
+	for _, name := range []string{"", "localhost", "not-allowed.example.com"} {
+		cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: name})
+		require.NoError(t, err)
+		assert.Same(t, m.static, cert, name)
+	}
+
+	const handshakes = 20
+	issued := make([]*tls.Certificate, handshakes)
+	wg := sync.WaitGroup{}
+	for i := range handshakes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "Shop.Test."})
+			assert.NoError(t, err)
+			issued[i] = cert
+		}()
+	}
+	wg.Wait()
+	require.NotNil(t, issued[0])
+	assert.Equal(t, []string{"shop.test"}, issued[0].Leaf.DNSNames)
+	for _, cert := range issued {
+		assert.Same(t, issued[0], cert)
+	}
+	assert.Len(t, m.issued, 1)
+}
+
+func TestCertManagerBoundsIssued(t *testing.T) {
+	m := newTestCertManager(t)
+	m.maxIssued = 3
+	for i := range 5 {
+		_, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: fmt.Sprintf("shop-%d.test", i)})
+		require.NoError(t, err)
+	}
+	assert.Len(t, m.issued, 3)
+	assert.Contains(t, m.issued, "shop-4.test")
+}
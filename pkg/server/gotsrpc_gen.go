@@ -12,8 +12,12 @@ import (
 )
 
 const (
-	ServiceGoTSRPCProxyRemove = "Remove"
-	ServiceGoTSRPCProxyUpsert = "Upsert"
+	ServiceGoTSRPCProxyRemove       = "Remove"
+	ServiceGoTSRPCProxyServices     = "Services"
+	ServiceGoTSRPCProxyStartCapture = "StartCapture"
+	ServiceGoTSRPCProxyStatus       = "Status"
+	ServiceGoTSRPCProxyStopCapture  = "StopCapture"
+	ServiceGoTSRPCProxyUpsert       = "Upsert"
 )
 
 type ServiceGoTSRPCProxy struct {
@@ -71,6 +75,66 @@ func (p *ServiceGoTSRPCProxy) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		}
 		gotsrpc.Monitor(w, r, args, rets, callStats)
 		return
+	case ServiceGoTSRPCProxyServices:
+		var (
+			args []interface{}
+			rets []interface{}
+		)
+		executionStart := time.Now()
+		servicesServices, servicesErr := p.service.Services()
+		callStats.Execution = time.Since(executionStart)
+		rets = []interface{}{servicesServices, servicesErr}
+		if err := gotsrpc.Reply(rets, callStats, r, w); err != nil {
+			gotsrpc.ErrorCouldNotReply(w)
+			return
+		}
+		gotsrpc.Monitor(w, r, args, rets, callStats)
+		return
+	case ServiceGoTSRPCProxyStartCapture:
+		var (
+			args []interface{}
+			rets []interface{}
+		)
+		executionStart := time.Now()
+		startCaptureErr := p.service.StartCapture()
+		callStats.Execution = time.Since(executionStart)
+		rets = []interface{}{startCaptureErr}
+		if err := gotsrpc.Reply(rets, callStats, r, w); err != nil {
+			gotsrpc.ErrorCouldNotReply(w)
+			return
+		}
+		gotsrpc.Monitor(w, r, args, rets, callStats)
+		return
+	case ServiceGoTSRPCProxyStatus:
+		var (
+			args []interface{}
+			rets []interface{}
+		)
+		executionStart := time.Now()
+		statusInstanceID, statusErr := p.service.Status()
+		callStats.Execution = time.Since(executionStart)
+		rets = []interface{}{statusInstanceID, statusErr}
+		if err := gotsrpc.Reply(rets, callStats, r, w); err != nil {
+			gotsrpc.ErrorCouldNotReply(w)
+			return
+		}
+		gotsrpc.Monitor(w, r, args, rets, callStats)
+		return
+	case ServiceGoTSRPCProxyStopCapture:
+		var (
+			args []interface{}
+			rets []interface{}
+		)
+		executionStart := time.Now()
+		stopCaptureFile, stopCaptureErr := p.service.StopCapture()
+		callStats.Execution = time.Since(executionStart)
+		rets = []interface{}{stopCaptureFile, stopCaptureErr}
+		if err := gotsrpc.Reply(rets, callStats, r, w); err != nil {
+			gotsrpc.ErrorCouldNotReply(w)
+			return
+		}
+		gotsrpc.Monitor(w, r, args, rets, callStats)
+		return
 	case ServiceGoTSRPCProxyUpsert:
 		var (
 			args []interface{}
@@ -13,6 +13,10 @@ import (
 
 type ServiceGoTSRPCClient interface {
 	Remove(ctx go_context.Context, serviceIDs []github_com_foomo_webgrapple_pkg_vo.ServiceID) (err *github_com_foomo_webgrapple_pkg_vo.ServiceError, clientErr error)
+	Services(ctx go_context.Context) (services []*github_com_foomo_webgrapple_pkg_vo.Service, err *github_com_foomo_webgrapple_pkg_vo.ServiceError, clientErr error)
+	StartCapture(ctx go_context.Context) (err *github_com_foomo_webgrapple_pkg_vo.ServiceError, clientErr error)
+	Status(ctx go_context.Context) (instanceID string, err *github_com_foomo_webgrapple_pkg_vo.ServiceError, clientErr error)
+	StopCapture(ctx go_context.Context) (file string, err *github_com_foomo_webgrapple_pkg_vo.ServiceError, clientErr error)
 	Upsert(ctx go_context.Context, services []*github_com_foomo_webgrapple_pkg_vo.Service) (err *github_com_foomo_webgrapple_pkg_vo.ServiceError, clientErr error)
 }
 
@@ -47,6 +51,46 @@ func (tsc *HTTPServiceGoTSRPCClient) Remove(ctx go_context.Context, serviceIDs [
 	return
 }
 
+func (tsc *HTTPServiceGoTSRPCClient) Services(ctx go_context.Context) (services []*github_com_foomo_webgrapple_pkg_vo.Service, err *github_com_foomo_webgrapple_pkg_vo.ServiceError, clientErr error) {
+	args := []interface{}{}
+	reply := []interface{}{&services, &err}
+	clientErr = tsc.Client.Call(ctx, tsc.URL, tsc.EndPoint, "Services", args, reply)
+	if clientErr != nil {
+		clientErr = pkg_errors.WithMessage(clientErr, "failed to call server.ServiceGoTSRPCProxy Services")
+	}
+	return
+}
+
+func (tsc *HTTPServiceGoTSRPCClient) StartCapture(ctx go_context.Context) (err *github_com_foomo_webgrapple_pkg_vo.ServiceError, clientErr error) {
+	args := []interface{}{}
+	reply := []interface{}{&err}
+	clientErr = tsc.Client.Call(ctx, tsc.URL, tsc.EndPoint, "StartCapture", args, reply)
+	if clientErr != nil {
+		clientErr = pkg_errors.WithMessage(clientErr, "failed to call server.ServiceGoTSRPCProxy StartCapture")
+	}
+	return
+}
+
+func (tsc *HTTPServiceGoTSRPCClient) Status(ctx go_context.Context) (instanceID string, err *github_com_foomo_webgrapple_pkg_vo.ServiceError, clientErr error) {
+	args := []interface{}{}
+	reply := []interface{}{&instanceID, &err}
+	clientErr = tsc.Client.Call(ctx, tsc.URL, tsc.EndPoint, "Status", args, reply)
+	if clientErr != nil {
+		clientErr = pkg_errors.WithMessage(clientErr, "failed to call server.ServiceGoTSRPCProxy Status")
+	}
+	return
+}
+
+func (tsc *HTTPServiceGoTSRPCClient) StopCapture(ctx go_context.Context) (file string, err *github_com_foomo_webgrapple_pkg_vo.ServiceError, clientErr error) {
+	args := []interface{}{}
+	reply := []interface{}{&file, &err}
+	clientErr = tsc.Client.Call(ctx, tsc.URL, tsc.EndPoint, "StopCapture", args, reply)
+	if clientErr != nil {
+		clientErr = pkg_errors.WithMessage(clientErr, "failed to call server.ServiceGoTSRPCProxy StopCapture")
+	}
+	return
+}
+
 func (tsc *HTTPServiceGoTSRPCClient) Upsert(ctx go_context.Context, services []*github_com_foomo_webgrapple_pkg_vo.Service) (err *github_com_foomo_webgrapple_pkg_vo.ServiceError, clientErr error) {
 	args := []interface{}{services}
 	reply := []interface{}{&err}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"github.com/foomo/webgrapple/pkg/certs"
+	"github.com/foomo/webgrapple/pkg/har"
+	"github.com/foomo/webgrapple/pkg/responsecache"
+)
+
+// Option configures optional behaviour of Run
+type Option func(o *options)
+
+type options struct {
+	backendProxyURL string
+	backendAuth     *BackendAuth
+	har             har.Config
+	harCapture      bool
+	responseCache   *responsecache.Config
+	caDir           string
+	certDir         string
+	caCertFile      string
+	caKeyFile       string
+	sniAllow        []string
+	leafConfig      certs.LeafConfig
+	acme            *ACMEConfig
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithBackendProxy send backend and service traffic through the given upstream proxy
+// (http, https, socks5 or socks5h url, credentials may be given as user info),
+// if not set HTTP_PROXY, HTTPS_PROXY and NO_PROXY from the environment are used
+func WithBackendProxy(proxyURL string) Option {
+	return func(o *options) {
+		o.backendProxyURL = proxyURL
+	}
+}
+
+// WithBackendAuth inject credentials into requests to the fallback backend, services never see them
+func WithBackendAuth(auth BackendAuth) Option {
+	return func(o *options) {
+		o.backendAuth = &auth
+	}
+}
+
+// WithHAR configure HAR recording, captures can be started and stopped through the service endpoint,
+// if capture is true, recording starts right away
+func WithHAR(config har.Config, capture bool) Option {
+	return func(o *options) {
+		o.har = config
+		o.harCapture = capture
+	}
+}
+
+// WithResponseCache record backend responses to disk, or replay them, when the config is offline,
+// services are still routed as usual
+func WithResponseCache(config responsecache.Config) Option {
+	return func(o *options) {
+		o.responseCache = &config
+	}
+}
+
+// WithCADir where to keep the local CA, that signs the proxies certificates, defaults to the users config dir
+func WithCADir(dir string) Option {
+	return func(o *options) {
+		o.caDir = dir
+	}
+}
+
+// WithCertDir where to keep generated certificates and keys, defaults to webgrapple/certs in the users state dir
+func WithCertDir(dir string) Option {
+	return func(o *options) {
+		o.certDir = dir
+	}
+}
+
+// WithSNIAllow issue certificates for SNI names matching one of the glob patterns (like *.test) while handshaking
+func WithSNIAllow(patterns []string) Option {
+	return func(o *options) {
+		o.sniAllow = patterns
+	}
+}
+
+// WithCA sign certificates with an existing CA like the one of mkcert, instead of the local webgrapple CA
+func WithCA(certFile, keyFile string) Option {
+	return func(o *options) {
+		o.caCertFile = certFile
+		o.caKeyFile = keyFile
+	}
+}
+
+// WithLeafConfig key type, validity, subject and extra SANs of issued certificates
+func WithLeafConfig(config certs.LeafConfig) Option {
+	return func(o *options) {
+		o.leafConfig = config
+	}
+}
+
+// WithACME get certificates from an ACME server instead of signing them with a local CA
+func WithACME(config ACMEConfig) Option {
+	return func(o *options) {
+		o.acme = &config
+	}
+}
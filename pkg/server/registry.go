@@ -3,6 +3,7 @@ package server
 import (
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 
 	"github.com/foomo/webgrapple/pkg/log"
@@ -79,3 +80,17 @@ func (r *registry) update(services ServiceMap) error {
 	r.state = newState
 	return nil
 }
+
+// serviceIDForRequest find the service, that a request to a service address is going to
+func (r *registry) serviceIDForRequest(req *http.Request) vo.ServiceID {
+	for id, service := range r.getServicesCopy() {
+		serviceURL, errParse := url.Parse(service.Address)
+		if errParse != nil {
+			continue
+		}
+		if serviceURL.Host == req.URL.Host && (serviceURL.Scheme == "" || serviceURL.Scheme == req.URL.Scheme) {
+			return id
+		}
+	}
+	return ""
+}
@@ -2,15 +2,19 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
+	"github.com/foomo/webgrapple/pkg/certs"
 	"github.com/foomo/webgrapple/pkg/httputils"
 	"github.com/foomo/webgrapple/pkg/log"
 	"golang.org/x/sync/errgroup"
@@ -85,61 +89,183 @@ func filesExist(files ...string) (bool, error) {
 	return true, nil
 }
 
+func hostNamesToStrings(hostNames []hostName) []string {
+	names := []string{}
+	for _, name := range hostNames {
+		names = append(names, string(name))
+	}
+	return names
+}
+
+func issueCertAndKey(l log.Logger, ca *certs.CA, leafConfig certs.LeafConfig, hosts []string, certFile, keyFile string) error {
+	l.Info(fmt.Sprintf("issuing certificate for %q signed by %q", leafConfig.Hosts(hosts), ca.Cert.Subject.CommonName))
+	certPEM, keyPEM, errIssue := ca.Issue(hosts, leafConfig)
+	if errIssue != nil {
+		return errIssue
+	}
+	return certs.WriteCertAndKey(certFile, keyFile, certPEM, keyPEM)
+}
+
+// ensureCertAndKey makes sure there is a usable cert and key, managed certificates live in the cert dir
+// and will be reissued, files named explicitly belong to the user and are never rewritten
 func ensureCertAndKey(
 	l log.Logger,
+	ca *certs.CA,
+	leafConfig certs.LeafConfig,
 	commonNames []hostName,
-	certFile, keyFile string,
-) (certFileCorrected, keyFileCorrected string, err error) {
+	certDir, certFile, keyFile string,
+) (certFileCorrected, keyFileCorrected string, managed bool, err error) {
 	var keyExists bool
 	var certExists bool
 
-	if certFile != "" && keyFile != "" {
+	explicit := certFile != "" && keyFile != ""
+	if explicit {
 		certExists, err = fileExistsAndIsAFile("cert", certFile)
 		if err != nil {
-			return certFile, keyFile, err
+			return certFile, keyFile, false, err
 		}
 		keyExists, err = fileExistsAndIsAFile("key", keyFile)
 		if err != nil {
-			return certFile, keyFile, err
+			return certFile, keyFile, false, err
 		}
 
 		if certExists && !keyExists {
-			return certFile, keyFile, errors.New("there is a cert file but no key, giving up")
+			return certFile, keyFile, false, errors.New("there is a cert file but no key, giving up")
 		}
 		if !certExists && keyExists {
-			return certFile, keyFile, errors.New("there is a key file but no cert, giving up")
+			return certFile, keyFile, false, errors.New("there is a key file but no cert, giving up")
 		}
 	} else {
-		certNameBase := "webgrapple-temp"
+		certNameBase := "webgrapple"
 		for _, commonName := range commonNames {
 			certNameBase += "-" + string(commonName)
 		}
-		tempDir := os.TempDir()
-		certFile = filepath.Join(tempDir, "cert-"+certNameBase+".pem")
-		keyFile = filepath.Join(tempDir, "key-"+certNameBase+".pem")
-		l.Info(fmt.Sprintf("no key or cert given - will try temporary files at %s and %s", certFile, keyFile))
+		if certDir == "" {
+			defaultCertDir, errCertDir := certs.DefaultStateDir()
+			if errCertDir != nil {
+				return certFile, keyFile, false, errCertDir
+			}
+			certDir = defaultCertDir
+		}
+		if errDir := certs.EnsurePrivateDir(certDir); errDir != nil {
+			return certFile, keyFile, false, errDir
+		}
+		certFile = filepath.Join(certDir, "cert-"+certNameBase+".pem")
+		keyFile = filepath.Join(certDir, "key-"+certNameBase+".pem")
+		migrateTempCertAndKey(l, ca, commonNames, certFile, keyFile)
+		l.Info(fmt.Sprintf("no key or cert given - will use %s and %s", certFile, keyFile))
 		certAndKeyExist, errFilesExist := filesExist(certFile, keyFile)
 		if errFilesExist != nil {
-			return certFile, keyFile, errFilesExist
+			return certFile, keyFile, false, errFilesExist
+		}
+		if certAndKeyExist {
+			if errPrivate := certs.CheckPrivateFile(keyFile); errPrivate != nil {
+				l.Info(fmt.Sprintf("not using existing key: %v", errPrivate))
+				certAndKeyExist = false
+			}
+		}
+		if certAndKeyExist {
+			cert, errRead := certs.ReadCertificate(certFile)
+			if errRead != nil || !ca.Signed(cert) {
+				l.Info("existing cert was not issued by the current CA")
+				certAndKeyExist = false
+			}
 		}
 		certExists = certAndKeyExist
 		keyExists = certAndKeyExist
 	}
 
-	if !certExists && !keyExists {
-		certCommonHostNames := []string{}
-		for _, certCommonName := range commonNames {
-			certCommonHostNames = append(certCommonHostNames, string(certCommonName))
+	hosts := hostNamesToStrings(commonNames)
+	if certExists && keyExists {
+		if errCheck := certs.CheckLeaf(certFile, keyFile, hosts, leafConfig, time.Now()); errCheck != nil {
+			if explicit {
+				l.Error(fmt.Sprintf("the given cert and key are not usable: %v", errCheck))
+				return certFile, keyFile, false, nil
+			}
+			l.Info(fmt.Sprintf("replacing existing cert: %v", errCheck))
+			certExists = false
+			keyExists = false
 		}
-		l.Info("generating self signed certificate and key")
-		errSign := selfsign(l, certCommonHostNames, certFile, keyFile)
-		if errSign != nil {
-			return certFile, keyFile, errSign
+	}
+
+	if !certExists && !keyExists {
+		if errIssue := issueCertAndKey(l, ca, leafConfig, hosts, certFile, keyFile); errIssue != nil {
+			return certFile, keyFile, false, errIssue
 		}
 	} else {
 		l.Info("using existing cert and key")
 	}
-	return certFile, keyFile, nil
+	return certFile, keyFile, !explicit, nil
+}
+
+// migrateTempCertAndKey move a cert and key, that older versions kept in the shared temp dir, into
+// the private cert dir, files owned by other users or readable by others are never trusted
+func migrateTempCertAndKey(l log.Logger, ca *certs.CA, commonNames []hostName, certFile, keyFile string) {
+	tempNameBase := "webgrapple-temp"
+	for _, commonName := range commonNames {
+		tempNameBase += "-" + string(commonName)
+	}
+	tempCertFile := filepath.Join(os.TempDir(), "cert-"+tempNameBase+".pem")
+	tempKeyFile := filepath.Join(os.TempDir(), "key-"+tempNameBase+".pem")
+	tempFilesExist, _ := filesExist(tempCertFile, tempKeyFile)
+	if !tempFilesExist {
+		return
+	}
+	if errPrivate := certs.CheckPrivateFile(tempKeyFile); errPrivate != nil {
+		l.Error(fmt.Sprintf("ignoring old temporary key, it may have been tampered with: %v", errPrivate))
+		return
+	}
+	defer func() {
+		for _, f := range []string{tempCertFile, tempKeyFile} {
+			if errRemove := os.Remove(f); errRemove != nil {
+				l.Error(fmt.Sprintf("could not remove old temporary file %q: %v", f, errRemove))
+			}
+		}
+	}()
+	if exist, _ := filesExist(certFile, keyFile); exist {
+		return
+	}
+	certPEM, errCert := os.ReadFile(tempCertFile)
+	keyPEM, errKey := os.ReadFile(tempKeyFile)
+	if errCert != nil || errKey != nil {
+		return
+	}
+	cert, errParse := certs.ParseCertificate(certPEM)
+	if errParse != nil || !ca.Signed(cert) {
+		return
+	}
+	if errWrite := certs.WriteCertAndKey(certFile, keyFile, certPEM, keyPEM); errWrite != nil {
+		l.Error(fmt.Sprintf("could not migrate old temporary cert and key: %v", errWrite))
+		return
+	}
+	l.Info(fmt.Sprintf("moved old temporary cert and key to %s and %s", certFile, keyFile))
+}
+
+// loadCA use an explicitly given CA, an mkcert CA from CAROOT, or the local webgrapple CA
+func loadCA(l log.Logger, o *options) (*certs.CA, error) {
+	caCertFile, caKeyFile, local, errResolve := certs.ResolveCAFiles(o.caDir, o.caCertFile, o.caKeyFile)
+	if errResolve != nil {
+		return nil, errResolve
+	}
+	switch {
+	case !local && o.caCertFile != "":
+		l.Info(fmt.Sprintf("signing certificates with CA %q", caCertFile))
+		return certs.LoadCA(caCertFile, caKeyFile)
+	case !local:
+		l.Info(fmt.Sprintf("signing certificates with mkcert CA from CAROOT %q", filepath.Dir(caCertFile)))
+		return certs.LoadCA(caCertFile, caKeyFile)
+	}
+	if caRoot := os.Getenv("CAROOT"); caRoot != "" {
+		l.Info(fmt.Sprintf("CAROOT %q does not contain a CA, falling back to the local webgrapple CA", caRoot))
+	}
+	ca, caCreated, errCA := certs.LoadOrCreateCA(filepath.Dir(caCertFile))
+	if errCA != nil {
+		return nil, errCA
+	}
+	if caCreated {
+		l.Info(fmt.Sprintf("created a new local CA %q, run \"webgrapple cert trust\" once to get rid of certificate warnings", ca.CertFile))
+	}
+	return ca, nil
 }
 
 func checkHosts(l log.Logger, hostList []hostName) map[hostName]string {
@@ -160,6 +286,28 @@ func checkHosts(l log.Logger, hostList []hostName) map[hostName]string {
 	return hostAdresses
 }
 
+// newLocalCertManager serve certificates signed by the local, mkcert or explicitly given CA
+func newLocalCertManager(l log.Logger, o *options, hosts []hostName, certFile, keyFile string) (*certManager, error) {
+	ca, errCA := loadCA(l, o)
+	if errCA != nil {
+		return nil, errors.New("could not load CA: " + errCA.Error())
+	}
+
+	certFile, keyFile, certManaged, errCertainly := ensureCertAndKey(l, ca, o.leafConfig, hosts, o.certDir, certFile, keyFile)
+	if errCertainly != nil {
+		return nil, errCertainly
+	}
+
+	cm, errCertManager := newCertManager(l, ca, o.leafConfig, certFile, keyFile, certManaged, hostNamesToStrings(hosts), o.sniAllow)
+	if errCertManager != nil {
+		return nil, errCertManager
+	}
+	if len(o.sniAllow) > 0 {
+		l.Info(fmt.Sprintf("issuing certificates on demand for sni names matching %q", o.sniAllow))
+	}
+	return cm, nil
+}
+
 func Run(
 	ctx context.Context,
 	l log.Logger,
@@ -167,7 +315,9 @@ func Run(
 	urlStrings []string,
 	certFile, keyFile string,
 	middlewareFactory WebGrappleMiddleWareCreator,
+	opts ...Option,
 ) error {
+	o := newOptions(opts...)
 	hosts, urls, errExtractHosts := extractDataFromURLStrings(urlStrings)
 	if errExtractHosts != nil {
 		return errExtractHosts
@@ -175,9 +325,30 @@ func Run(
 
 	hostAddresses := checkHosts(l, hosts)
 
-	certFile, keyFile, errCertainly := ensureCertAndKey(l, hosts, certFile, keyFile)
-	if errCertainly != nil {
-		return errCertainly
+	var tlsConfig func() *tls.Config
+	var renewCerts func(ctx context.Context)
+	var wrapHTTP func(h http.Handler) http.Handler
+	if o.acme != nil {
+		if certFile != "" || keyFile != "" {
+			l.Info("ignoring the given cert and key, certificates come from ACME")
+		}
+		acmeManager, errACME := newACMEManager(l, *o.acme, hostNamesToStrings(hosts), o.sniAllow)
+		if errACME != nil {
+			return errACME
+		}
+		// tls-alpn-01 challenges are answered while handshaking, autocert renews on its own
+		tlsConfig = acmeManager.TLSConfig
+		renewCerts = func(ctx context.Context) {}
+		// http-01 challenges, everything else goes to the proxy
+		wrapHTTP = acmeManager.HTTPHandler
+	} else {
+		cm, errCertManager := newLocalCertManager(l, o, hosts, certFile, keyFile)
+		if errCertManager != nil {
+			return errCertManager
+		}
+		tlsConfig = cm.tlsConfig
+		renewCerts = cm.renew
+		wrapHTTP = func(h http.Handler) http.Handler { return h }
 	}
 
 	backendURL, errParseBackendURL := url.Parse(backendURLString)
@@ -185,11 +356,39 @@ func Run(
 		return errors.New("could not parse backend url: " + errParseBackendURL.Error())
 	}
 
-	s, errServer := newServer(backendURL, l, middlewareFactory)
+	if o.responseCache != nil {
+		if o.responseCache.Offline {
+			l.Info(fmt.Sprintf("offline - replaying backend responses from %q", o.responseCache.Dir))
+		} else {
+			l.Info(fmt.Sprintf("recording backend responses to %q", o.responseCache.Dir))
+		}
+	}
+
+	if o.backendProxyURL != "" {
+		l.Info(fmt.Sprintf("sending backend traffic through proxy %q", redactURL(o.backendProxyURL)))
+	}
+
+	s, errServer := newServer(backendURL, l, middlewareFactory, o)
 	if errServer != nil {
 		return errServer
 	}
 
+	if o.harCapture {
+		l.Info("starting HAR capture")
+		s.recorder.Start()
+	}
+	defer func() {
+		if !s.recorder.Recording() {
+			return
+		}
+		harFile, entries, errStop := s.recorder.Stop()
+		if errStop != nil {
+			l.Error(fmt.Sprintf("could not write HAR capture: %v", errStop))
+			return
+		}
+		l.Info(fmt.Sprintf("wrote %d HAR entries to %q", entries, harFile))
+	}()
+
 	usedAddressPorts := map[string]int{}
 	g, gctx := errgroup.WithContext(ctx)
 
@@ -222,11 +421,13 @@ func Run(
 		if usedAddressPorts[addressPort] == 1 {
 			g.Go(func() error {
 				name := fmt.Sprintf("proxy (%s)", u)
-				httpServer := httputils.GracefulHTTPServer(gctx, l, name, listenAddress, s)
 				l.Info(fmt.Sprintf("starting server on %s", addressPort))
 				if useTLS {
-					return httpServer.ListenAndServeTLS(certFile, keyFile)
+					httpServer := httputils.GracefulHTTPServer(gctx, l, name, listenAddress, s)
+					httpServer.TLSConfig = tlsConfig()
+					return httpServer.ListenAndServeTLS("", "")
 				}
+				httpServer := httputils.GracefulHTTPServer(gctx, l, name, listenAddress, wrapHTTP(s))
 				return httpServer.ListenAndServe()
 			})
 		} else {
@@ -234,6 +435,11 @@ func Run(
 		}
 	}
 
+	g.Go(func() error {
+		renewCerts(gctx)
+		return nil
+	})
+
 	g.Go(func() error {
 		l.Info(fmt.Sprintf("starting dev client service on %q", serviceAddress))
 		httpDevClient := httputils.GracefulHTTPServer(gctx, l, "dev-client", serviceAddress, s.serviceHandler)
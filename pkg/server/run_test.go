@@ -0,0 +1,73 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/foomo/webgrapple/pkg/certs"
+	"github.com/foomo/webgrapple/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnsureCertAndKeyNeverRewritesExplicitFiles(t *testing.T) {
+	l := utils.GetLogger().Sugar()
+	dir := t.TempDir()
+	ca, _, errCA := certs.LoadOrCreateCA(filepath.Join(dir, "ca"))
+	require.NoError(t, errCA)
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	// signed by the active CA, but for another host and about to expire
+	require.NoError(t, issueCertAndKey(l, ca, certs.LeafConfig{Validity: 70 * time.Minute}, []string{"other.test"}, certFile, keyFile))
+	certPEM, errCert := os.ReadFile(certFile)
+	require.NoError(t, errCert)
+	keyPEM, errKey := os.ReadFile(keyFile)
+	require.NoError(t, errKey)
+	unchanged := func() {
+		t.Helper()
+		currentCertPEM, errCert := os.ReadFile(certFile)
+		require.NoError(t, errCert)
+		currentKeyPEM, errKey := os.ReadFile(keyFile)
+		require.NoError(t, errKey)
+		assert.Equal(t, string(certPEM), string(currentCertPEM))
+		assert.Equal(t, string(keyPEM), string(currentKeyPEM))
+	}
+
+	usedCertFile, usedKeyFile, managed, errEnsure := ensureCertAndKey(l, ca, certs.LeafConfig{}, []hostName{"localhost"}, filepath.Join(dir, "certs"), certFile, keyFile)
+	require.NoError(t, errEnsure)
+	assert.False(t, managed)
+	assert.Equal(t, certFile, usedCertFile)
+	assert.Equal(t, keyFile, usedKeyFile)
+	unchanged()
+
+	m, errManager := newCertManager(l, ca, certs.LeafConfig{}, certFile, keyFile, managed, []string{"localhost"}, nil)
+	require.NoError(t, errManager)
+	require.True(t, certs.NeedsRenewal(m.static.Leaf, time.Now()))
+	m.renewStatic()
+	unchanged()
+	assert.Equal(t, []string{"other.test"}, m.static.Leaf.DNSNames)
+}
+
+func TestEnsureCertAndKeyManagesTheCertDir(t *testing.T) {
+	l := utils.GetLogger().Sugar()
+	dir := t.TempDir()
+	ca, _, errCA := certs.LoadOrCreateCA(filepath.Join(dir, "ca"))
+	require.NoError(t, errCA)
+	certDir := filepath.Join(dir, "certs")
+
+	certFile, keyFile, managed, errEnsure := ensureCertAndKey(l, ca, certs.LeafConfig{}, []hostName{"localhost"}, certDir, "", "")
+	require.NoError(t, errEnsure)
+	assert.True(t, managed)
+	assert.Equal(t, certDir, filepath.Dir(certFile))
+	assert.Equal(t, certDir, filepath.Dir(keyFile))
+	require.NoError(t, certs.CheckLeaf(certFile, keyFile, []string{"localhost"}, certs.LeafConfig{}, time.Now()))
+
+	// a cert in the cert dir, that does not fit anymore, is replaced
+	require.NoError(t, issueCertAndKey(l, ca, certs.LeafConfig{}, []string{"other.test"}, certFile, keyFile))
+	_, _, managed, errEnsure = ensureCertAndKey(l, ca, certs.LeafConfig{}, []hostName{"localhost"}, certDir, "", "")
+	require.NoError(t, errEnsure)
+	assert.True(t, managed)
+	require.NoError(t, certs.CheckLeaf(certFile, keyFile, []string{"localhost"}, certs.LeafConfig{}, time.Now()))
+}
@@ -1,12 +1,16 @@
 package server
 
 import (
-	"crypto/tls"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 
+	"github.com/foomo/webgrapple/pkg/har"
 	"github.com/foomo/webgrapple/pkg/log"
+	"github.com/foomo/webgrapple/pkg/responsecache"
 )
 
 const DefaultServiceURL = "http://127.0.0.1:8888"
@@ -15,33 +19,66 @@ const DefaultEndPoint = "/___webgrapple-service"
 type srvr struct {
 	r                   *registry
 	serviceHandler      http.Handler
+	serviceTransport    http.RoundTripper
 	defaultProxyHandler http.HandlerFunc
+	recorder            *har.Recorder
 }
 
-func newServer(backendURL *url.URL, l log.Logger, middlewareFactory WebGrappleMiddleWareCreator) (*srvr, error) {
-	defaultProxy := httputil.NewSingleHostReverseProxy(backendURL)
-	defaultProxy.Transport = &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
+func newServer(backendURL *url.URL, l log.Logger, middlewareFactory WebGrappleMiddleWareCreator, o *options) (*srvr, error) {
+	proxy, errProxy := newProxyFunc(o.backendProxyURL)
+	if errProxy != nil {
+		return nil, errProxy
+	}
+	backendTransport, errAuth := newAuthTransport(o.backendAuth, newTransport(proxy), proxy)
+	if errAuth != nil {
+		return nil, errAuth
+	}
+	if o.responseCache != nil {
+		cache, errCache := responsecache.New(*o.responseCache)
+		if errCache != nil {
+			return nil, errCache
+		}
+		backendTransport = cache.Transport(backendTransport)
 	}
 	r := newRegistry(l, backendURL, middlewareFactory)
+	// recording happens before auth injection, so that credentials never end up in HAR files
+	recorder := har.NewRecorder(o.har)
+	defaultProxy := httputil.NewSingleHostReverseProxy(backendURL)
+	defaultProxy.Transport = recorder.Transport(har.TargetBackend, backendTransport, nil)
+	instanceID, errInstanceID := newInstanceID()
+	if errInstanceID != nil {
+		return nil, errInstanceID
+	}
 	service := &Service{
-		r: r,
+		r:          r,
+		l:          l,
+		recorder:   recorder,
+		instanceID: instanceID,
 	}
 	serviceHandler := NewDefaultServiceGoTSRPCProxy(service)
 	return &srvr{
 		r:                   r,
 		serviceHandler:      serviceHandler,
+		serviceTransport:    recorder.Transport(har.TargetService, newTransport(proxy), r.serviceIDForRequest),
 		defaultProxyHandler: defaultProxy.ServeHTTP,
+		recorder:            recorder,
 	}, nil
 }
 
 func (s *srvr) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if s.r.state != nil && s.r.state.middleware != nil {
+		r = r.WithContext(context.WithValue(r.Context(), transportContextKey{}, s.serviceTransport))
 		s.r.state.middleware(s.defaultProxyHandler)(w, r)
 	} else {
 		s.r.logger.Info("you might want to bring up some services, passing request on to backend")
 		http.Error(w, "not available - please register at least one service, so that we can bring up your middleware", http.StatusServiceUnavailable)
 	}
 }
+
+func newInstanceID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
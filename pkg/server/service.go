@@ -1,12 +1,23 @@
 package server
 
-import "github.com/foomo/webgrapple/pkg/vo"
+import (
+	"fmt"
+	"sort"
+
+	"github.com/foomo/webgrapple/pkg/har"
+	"github.com/foomo/webgrapple/pkg/log"
+	"github.com/foomo/webgrapple/pkg/vo"
+)
 
 type Service struct {
-	r *registry
+	r        *registry
+	l        log.Logger
+	recorder *har.Recorder
+	// instanceID changes with every start of the proxy, clients use it to notice restarts
+	instanceID string
 }
 
-func (s *Service) Upsert(services []*vo.Service) *vo.ServiceError {
+func (s *Service) Upsert(services []*vo.Service) (err *vo.ServiceError) {
 	errUpsert := s.r.upsert(services)
 	if errUpsert != nil {
 		return &vo.ServiceError{
@@ -16,7 +27,7 @@ func (s *Service) Upsert(services []*vo.Service) *vo.ServiceError {
 	return nil
 }
 
-func (s *Service) Remove(serviceIDs []vo.ServiceID) *vo.ServiceError {
+func (s *Service) Remove(serviceIDs []vo.ServiceID) (err *vo.ServiceError) {
 	errRemove := s.r.remove(serviceIDs)
 	if errRemove != nil {
 		return &vo.ServiceError{
@@ -25,3 +36,39 @@ func (s *Service) Remove(serviceIDs []vo.ServiceID) *vo.ServiceError {
 	}
 	return nil
 }
+
+// StartCapture start recording proxied traffic into a HAR file
+func (s *Service) StartCapture() (err *vo.ServiceError) {
+	s.l.Info("starting HAR capture")
+	s.recorder.Start()
+	return nil
+}
+
+// StopCapture stop recording and write the HAR file
+func (s *Service) StopCapture() (file string, err *vo.ServiceError) {
+	file, entries, errStop := s.recorder.Stop()
+	if errStop != nil {
+		return "", &vo.ServiceError{
+			Err: errStop.Error(),
+		}
+	}
+	s.l.Info(fmt.Sprintf("wrote %d HAR entries to %q", entries, file))
+	return file, nil
+}
+
+// Status tells clients, that the proxy is up and which instance is running
+func (s *Service) Status() (instanceID string, err *vo.ServiceError) {
+	return s.instanceID, nil
+}
+
+// Services the registered services, ordered by id
+func (s *Service) Services() (services []*vo.Service, err *vo.ServiceError) {
+	services = []*vo.Service{}
+	for _, service := range s.r.getServicesCopy() {
+		services = append(services, service)
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].ID < services[j].ID
+	})
+	return services, nil
+}
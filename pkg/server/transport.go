@@ -0,0 +1,79 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+type proxyFunc func(r *http.Request) (*url.URL, error)
+
+type transportContextKey struct{}
+
+type contextTransport struct{}
+
+// ServiceTransport use it as the Transport of the reverse proxies your middleware creates for services,
+// requests will be sent with the transport of the serving webgrapple server and pick up its upstream proxy settings
+var ServiceTransport http.RoundTripper = contextTransport{}
+
+func (contextTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if transport, ok := r.Context().Value(transportContextKey{}).(http.RoundTripper); ok {
+		return transport.RoundTrip(r)
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// newProxyFunc resolves upstream proxies from the environment, an explicit proxy url takes
+// precedence over HTTP_PROXY and HTTPS_PROXY, while NO_PROXY is always respected
+func newProxyFunc(proxyURLString string) (proxyFunc, error) {
+	config := httpproxy.FromEnvironment()
+	if proxyURLString != "" {
+		proxyURL, errParse := url.Parse(proxyURLString)
+		if errParse != nil {
+			return nil, errors.New("could not parse backend proxy url: " + errParse.Error())
+		}
+		switch proxyURL.Scheme {
+		case schemeHTTP, schemeHTTPS, "socks5", "socks5h":
+		default:
+			return nil, errors.New("unsupported backend proxy scheme " + proxyURL.Scheme + ", use http, https, socks5 or socks5h")
+		}
+		if proxyURL.Host == "" {
+			return nil, errors.New("backend proxy url is missing a host")
+		}
+		config.HTTPProxy = proxyURLString
+		config.HTTPSProxy = proxyURLString
+	}
+	resolve := config.ProxyFunc()
+	return func(r *http.Request) (*url.URL, error) {
+		return resolve(r.URL)
+	}, nil
+}
+
+// newVerifyingTransport verifies certificates, for endpoints, that get credentials, like oauth2 token urls
+func newVerifyingTransport(proxy proxyFunc) *http.Transport {
+	return &http.Transport{
+		Proxy:           proxy,
+		TLSClientConfig: &tls.Config{MinVersion: tls.VersionTLS12},
+	}
+}
+
+func newTransport(proxy proxyFunc) *http.Transport {
+	return &http.Transport{
+		Proxy: proxy,
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+		},
+	}
+}
+
+// redactURL hides proxy credentials before logging
+func redactURL(urlString string) string {
+	u, errParse := url.Parse(urlString)
+	if errParse != nil {
+		return urlString
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,284 @@
+package truststore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/foomo/webgrapple/pkg/certs"
+	"github.com/foomo/webgrapple/pkg/log"
+)
+
+// NamePrefix of the nickname and file name of a webgrapple root in trust stores
+const NamePrefix = "webgrapple-rootCA"
+
+// Name nickname and file name of a CA in trust stores, derived from its key id, so that the CAs of
+// several users or machines do not replace each other
+func Name(caCert *x509.Certificate) string {
+	id := caCert.SubjectKeyId
+	if len(id) == 0 {
+		sum := sha256.Sum256(caCert.RawSubjectPublicKeyInfo)
+		id = sum[:]
+	}
+	if len(id) > 8 {
+		id = id[:8]
+	}
+	return NamePrefix + "-" + hex.EncodeToString(id)
+}
+
+// systemLayout a system trust anchor directory and the command, that refreshes the trust store
+type systemLayout struct {
+	dir    string
+	update []string
+}
+
+// systemLayouts update-ca-certificates (debian, ubuntu, opensuse) and p11-kit (fedora, arch) layouts
+var systemLayouts = []systemLayout{
+	{dir: "/usr/local/share/ca-certificates", update: []string{"update-ca-certificates"}},
+	{dir: "/etc/pki/ca-trust/source/anchors", update: []string{"update-ca-trust", "extract"}},
+	{dir: "/etc/ca-certificates/trust-source/anchors", update: []string{"trust", "extract-compat"}},
+	{dir: "/usr/share/pki/trust/anchors", update: []string{"update-ca-certificates"}},
+}
+
+// Config where to install a CA
+type Config struct {
+	// Name of the anchor file and nickname in NSS databases, derived from the CA if empty
+	Name string
+	// SkipSystem do not touch the system trust store
+	SkipSystem bool
+	// SystemAnchorsDir system anchors directory, detected if empty
+	SystemAnchorsDir string
+	// SystemUpdateCommand refreshes the system trust store, if empty it is detected with the anchors dir,
+	// when SystemAnchorsDir is given no command will be run unless configured
+	SystemUpdateCommand []string
+	// SkipNSS do not touch NSS databases
+	SkipNSS bool
+	// NSSDBs NSS database directories, if nil the databases of Chromium and Firefox profiles are detected
+	NSSDBs []string
+	// Certutil path to the NSS certutil binary
+	Certutil string
+}
+
+// withName fills in the name derived from the CA cert, unless one was configured
+func (c Config) withName(caCertFile string) (Config, error) {
+	if c.Name != "" {
+		return c, nil
+	}
+	caCert, errRead := certs.ReadCertificate(caCertFile)
+	if errRead != nil {
+		return c, fmt.Errorf("could not read CA cert: %w", errRead)
+	}
+	c.Name = Name(caCert)
+	return c, nil
+}
+
+func (c Config) systemTarget() (dir string, update []string, err error) {
+	if c.SystemAnchorsDir != "" {
+		return c.SystemAnchorsDir, c.SystemUpdateCommand, nil
+	}
+	for _, layout := range systemLayouts {
+		if info, errStat := os.Stat(layout.dir); errStat == nil && info.IsDir() {
+			update = layout.update
+			if len(c.SystemUpdateCommand) > 0 {
+				update = c.SystemUpdateCommand
+			}
+			return layout.dir, update, nil
+		}
+	}
+	return "", nil, errors.New("no supported system trust anchors directory found, use an explicit anchors dir")
+}
+
+func (c Config) nssDBs() []string {
+	if c.NSSDBs != nil {
+		return c.NSSDBs
+	}
+	home, errHome := os.UserHomeDir()
+	if errHome != nil {
+		return nil
+	}
+	dbs := []string{}
+	for _, chromiumDB := range []string{
+		filepath.Join(home, ".pki", "nssdb"),
+		filepath.Join(home, "snap", "chromium", "current", ".pki", "nssdb"),
+	} {
+		if info, errStat := os.Stat(chromiumDB); errStat == nil && info.IsDir() {
+			dbs = append(dbs, chromiumDB)
+		}
+	}
+	for _, profilesGlob := range []string{
+		filepath.Join(home, ".mozilla", "firefox", "*"),
+		filepath.Join(home, "snap", "firefox", "common", ".mozilla", "firefox", "*"),
+		filepath.Join(home, ".var", "app", "org.mozilla.firefox", ".mozilla", "firefox", "*"),
+	} {
+		profiles, _ := filepath.Glob(profilesGlob)
+		for _, profile := range profiles {
+			if _, errStat := os.Stat(filepath.Join(profile, "cert9.db")); errStat == nil {
+				dbs = append(dbs, profile)
+			}
+		}
+	}
+	return dbs
+}
+
+func (c Config) certutil() (string, error) {
+	if c.Certutil != "" {
+		return c.Certutil, nil
+	}
+	certutil, errLookPath := exec.LookPath("certutil")
+	if errLookPath != nil {
+		return "", errors.New("certutil not found, install libnss3-tools (debian, ubuntu) or nss-tools (fedora, arch)")
+	}
+	return certutil, nil
+}
+
+// Install add the CA certificate to the system trust store and NSS databases
+func Install(l log.Logger, caCertFile string, config Config) error {
+	certPEM, errRead := os.ReadFile(caCertFile)
+	if errRead != nil {
+		return fmt.Errorf("could not read CA cert: %w", errRead)
+	}
+	config, errName := config.withName(caCertFile)
+	if errName != nil {
+		return errName
+	}
+	var errs []error
+	if !config.SkipSystem {
+		if err := installSystem(l, certPEM, config); err != nil {
+			errs = append(errs, fmt.Errorf("system trust store: %w", err))
+		}
+	}
+	if !config.SkipNSS {
+		errs = append(errs, forEachNSSDB(l, config, func(certutil, db string) error {
+			l.Info(fmt.Sprintf("adding %q to NSS database %q", config.Name, db))
+			return run(false, certutil, "-A", "-d", "sql:"+db, "-t", "C,,", "-n", config.Name, "-i", caCertFile)
+		}))
+	}
+	return errors.Join(errs...)
+}
+
+// Uninstall remove the CA certificate from the system trust store and NSS databases
+func Uninstall(l log.Logger, caCertFile string, config Config) error {
+	config, errName := config.withName(caCertFile)
+	if errName != nil {
+		return errName
+	}
+	var errs []error
+	if !config.SkipSystem {
+		if err := uninstallSystem(l, config); err != nil {
+			errs = append(errs, fmt.Errorf("system trust store: %w", err))
+		}
+	}
+	if !config.SkipNSS {
+		errs = append(errs, forEachNSSDB(l, config, func(certutil, db string) error {
+			if run(false, certutil, "-L", "-d", "sql:"+db, "-n", config.Name) != nil {
+				// not in there
+				return nil
+			}
+			l.Info(fmt.Sprintf("removing %q from NSS database %q", config.Name, db))
+			return run(false, certutil, "-D", "-d", "sql:"+db, "-n", config.Name)
+		}))
+	}
+	return errors.Join(errs...)
+}
+
+func forEachNSSDB(l log.Logger, config Config, f func(certutil, db string) error) error {
+	dbs := config.nssDBs()
+	if len(dbs) == 0 {
+		l.Info("no NSS databases found")
+		return nil
+	}
+	certutil, errCertutil := config.certutil()
+	if errCertutil != nil {
+		return errCertutil
+	}
+	var errs []error
+	for _, db := range dbs {
+		if err := f(certutil, db); err != nil {
+			errs = append(errs, fmt.Errorf("NSS database %q: %w", db, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func anchorFile(dir string, config Config) string {
+	return filepath.Join(dir, config.Name+".crt")
+}
+
+func installSystem(l log.Logger, certPEM []byte, config Config) error {
+	dir, update, errTarget := config.systemTarget()
+	if errTarget != nil {
+		return errTarget
+	}
+	file := anchorFile(dir, config)
+	l.Info(fmt.Sprintf("writing system trust anchor %q", file))
+	asRoot := false
+	errWrite := os.WriteFile(file, certPEM, 0o644)
+	if errors.Is(errWrite, os.ErrPermission) {
+		asRoot = true
+		errWrite = runWithInput(true, certPEM, "tee", file)
+	}
+	if errWrite != nil {
+		return errWrite
+	}
+	return updateSystem(l, asRoot, update)
+}
+
+func uninstallSystem(l log.Logger, config Config) error {
+	dir, update, errTarget := config.systemTarget()
+	if errTarget != nil {
+		return errTarget
+	}
+	file := anchorFile(dir, config)
+	if _, errStat := os.Stat(file); errors.Is(errStat, os.ErrNotExist) {
+		l.Info(fmt.Sprintf("system trust anchor %q does not exist", file))
+		return nil
+	}
+	l.Info(fmt.Sprintf("removing system trust anchor %q", file))
+	asRoot := false
+	errRemove := os.Remove(file)
+	if errors.Is(errRemove, os.ErrPermission) {
+		asRoot = true
+		errRemove = run(true, "rm", "-f", file)
+	}
+	if errRemove != nil {
+		return errRemove
+	}
+	return updateSystem(l, asRoot, update)
+}
+
+func updateSystem(l log.Logger, asRoot bool, update []string) error {
+	if len(update) == 0 {
+		l.Info("no system trust store update command configured, skipping the update")
+		return nil
+	}
+	l.Info(fmt.Sprintf("updating the system trust store with %q", strings.Join(update, " ")))
+	return run(asRoot, update[0], update[1:]...)
+}
+
+func run(asRoot bool, name string, args ...string) error {
+	return runWithInput(asRoot, nil, name, args...)
+}
+
+// runWithInput run a command, through sudo, if we need to be root and are not
+func runWithInput(asRoot bool, input []byte, name string, args ...string) error {
+	if asRoot && os.Geteuid() != 0 {
+		args = append([]string{"--", name}, args...)
+		name = "sudo"
+	}
+	cmd := exec.Command(name, args...)
+	if input != nil {
+		cmd.Stdin = bytes.NewReader(input)
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package truststore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/foomo/webgrapple/pkg/certs"
+	"github.com/foomo/webgrapple/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCA(t *testing.T) *certs.CA {
+	t.Helper()
+	ca, _, errCA := certs.LoadOrCreateCA(filepath.Join(t.TempDir(), "ca"))
+	require.NoError(t, errCA)
+	return ca
+}
+
+func TestName(t *testing.T) {
+	ca := newCA(t)
+	name := Name(ca.Cert)
+	assert.True(t, strings.HasPrefix(name, NamePrefix+"-"), name)
+	assert.Len(t, name, len(NamePrefix)+1+16)
+	assert.Equal(t, name, Name(ca.Cert))
+	assert.NotEqual(t, name, Name(newCA(t).Cert))
+}
+
+func TestInstallSystemAnchors(t *testing.T) {
+	l := utils.GetLogger().Sugar()
+	ca := newCA(t)
+	dir := t.TempDir()
+	anchorsDir := filepath.Join(dir, "anchors")
+	require.NoError(t, os.Mkdir(anchorsDir, 0o755))
+	updated := filepath.Join(dir, "updated")
+	config := Config{
+		SystemAnchorsDir:    anchorsDir,
+		SystemUpdateCommand: []string{"touch", updated},
+		SkipNSS:             true,
+	}
+	anchor := filepath.Join(anchorsDir, Name(ca.Cert)+".crt")
+
+	require.NoError(t, Install(l, ca.CertFile, config))
+	assert.FileExists(t, anchor)
+	assert.FileExists(t, updated)
+
+	require.NoError(t, os.Remove(updated))
+	require.NoError(t, Uninstall(l, ca.CertFile, config))
+	assert.NoFileExists(t, anchor)
+	assert.FileExists(t, updated)
+}
+
+// fakeCertutil logs its arguments and keeps the nicknames of a database in a file next to the log
+func fakeCertutil(t *testing.T) (certutil, calls string) {
+	t.Helper()
+	dir := t.TempDir()
+	certutil = filepath.Join(dir, "certutil")
+	calls = filepath.Join(dir, "calls")
+	script := `#!/bin/sh
+echo "$@" >> "` + calls + `"
+while [ $# -gt 0 ]; do
+	case "$1" in
+		-A|-L|-D) action="$1" ;;
+		-d) db="${2#sql:}"; shift ;;
+		-n) name="$2"; shift ;;
+	esac
+	shift
+done
+case "$action" in
+	-A) echo "$name" >> "$db/nicknames" ;;
+	-L) grep -qx "$name" "$db/nicknames" 2>/dev/null ;;
+	-D) grep -vx "$name" "$db/nicknames" > "$db/nicknames.tmp"; mv "$db/nicknames.tmp" "$db/nicknames" ;;
+esac
+`
+	require.NoError(t, os.WriteFile(certutil, []byte(script), 0o700))
+	return certutil, calls
+}
+
+func readLines(t *testing.T, file string) []string {
+	t.Helper()
+	data, errRead := os.ReadFile(file)
+	if os.IsNotExist(errRead) {
+		return []string{}
+	}
+	require.NoError(t, errRead)
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func TestInstallNSS(t *testing.T) {
+	l := utils.GetLogger().Sugar()
+	ca := newCA(t)
+	name := Name(ca.Cert)
+	certutil, calls := fakeCertutil(t)
+	dbs := []string{t.TempDir(), t.TempDir()}
+	config := Config{
+		SkipSystem: true,
+		NSSDBs:     dbs,
+		Certutil:   certutil,
+	}
+
+	require.NoError(t, Install(l, ca.CertFile, config))
+	assert.Equal(t, []string{
+		"-A -d sql:" + dbs[0] + " -t C,, -n " + name + " -i " + ca.CertFile,
+		"-A -d sql:" + dbs[1] + " -t C,, -n " + name + " -i " + ca.CertFile,
+	}, readLines(t, calls))
+	for _, db := range dbs {
+		assert.Equal(t, []string{name}, readLines(t, filepath.Join(db, "nicknames")))
+	}
+
+	// another CA in the same databases stays untouched
+	other := newCA(t)
+	require.NoError(t, Install(l, other.CertFile, Config{SkipSystem: true, NSSDBs: dbs[:1], Certutil: certutil}))
+
+	require.NoError(t, os.Remove(calls))
+	require.NoError(t, Uninstall(l, ca.CertFile, config))
+	assert.Equal(t, []string{
+		"-L -d sql:" + dbs[0] + " -n " + name,
+		"-D -d sql:" + dbs[0] + " -n " + name,
+		"-L -d sql:" + dbs[1] + " -n " + name,
+		"-D -d sql:" + dbs[1] + " -n " + name,
+	}, readLines(t, calls))
+	assert.Equal(t, []string{Name(other.Cert)}, readLines(t, filepath.Join(dbs[0], "nicknames")))
+
+	// nothing left to remove
+	require.NoError(t, os.Remove(calls))
+	require.NoError(t, Uninstall(l, ca.CertFile, config))
+	assert.Equal(t, []string{
+		"-L -d sql:" + dbs[0] + " -n " + name,
+		"-L -d sql:" + dbs[1] + " -n " + name,
+	}, readLines(t, calls))
+}
+
+func TestInstallNSSErrors(t *testing.T) {
+	l := utils.GetLogger().Sugar()
+	ca := newCA(t)
+	failing := filepath.Join(t.TempDir(), "certutil")
+	require.NoError(t, os.WriteFile(failing, []byte("#!/bin/sh\necho broken database\nexit 1\n"), 0o700))
+	db := t.TempDir()
+
+	errInstall := Install(l, ca.CertFile, Config{SkipSystem: true, NSSDBs: []string{db}, Certutil: failing})
+	require.Error(t, errInstall)
+	assert.ErrorContains(t, errInstall, db)
+	assert.ErrorContains(t, errInstall, "broken database")
+
+	// no databases, no certutil needed
+	require.NoError(t, Install(l, ca.CertFile, Config{SkipSystem: true, NSSDBs: []string{}, Certutil: "/does/not/exist"}))
+
+	errMissingCA := Install(l, filepath.Join(db, "missing.pem"), Config{SkipSystem: true, SkipNSS: true})
+	assert.ErrorContains(t, errMissingCA, "could not read CA cert")
+}
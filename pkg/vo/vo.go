@@ -3,11 +3,50 @@ package vo
 // ServiceID an identifier for a service
 type ServiceID string
 
+// service types
+const (
+	// ServiceTypeExec a command started by client-exec
+	ServiceTypeExec = "exec"
+	// ServiceTypeNPM a node dev server started by client-npm
+	ServiceTypeNPM = "npm"
+	// ServiceTypeRemote a server, that is already running at its address
+	ServiceTypeRemote = "remote"
+)
+
 // Service a service to proxy to
 type Service struct {
 	ID      ServiceID              `yaml:"id"`
 	Address string                 `yaml:"address"`
 	Custom  map[string]interface{} `yaml:"custom"`
+	// Type how the service is run, one of the service types, empty for configs without a type
+	Type string `yaml:"type"`
+	// Routes path patterns, that the service takes over, for the middleware to route by
+	Routes []string `yaml:"routes"`
+	// Headers request headers, that the middleware adds, when proxying to the service
+	Headers map[string]string `yaml:"headers"`
+	// HealthPath is requested to tell, if the service is ready, if empty a tcp connect is enough
+	HealthPath string `yaml:"healthPath"`
+	// Command starts the service locally, when running all services from one config
+	Command []string `yaml:"command"`
+	// Dir the command runs in, relative to the config
+	Dir string `yaml:"dir"`
+	// EnvFiles dotenv files for the command, relative to the config
+	EnvFiles []string `yaml:"envFiles"`
+	// Env additional env vars for the command, ${VAR} references are expanded
+	Env map[string]string `yaml:"env"`
+	// Watch globs of files relative to the dir the command runs in, when they change, the command is
+	// restarted, ** matches any dirs, a plain dir matches everything in it, globs starting with ! exclude files
+	Watch []string `yaml:"watch"`
+	// Debug how to attach a debugger, set by clients, when the command runs with an inspector
+	Debug *Debug `yaml:"debug,omitempty"`
+}
+
+// Debug inspector of a service
+type Debug struct {
+	// WebSocketURL of the inspector, e.g. ws://127.0.0.1:9229/<id>
+	WebSocketURL string `yaml:"webSocketURL"`
+	// DevToolsURL opens Chrome DevTools attached to the inspector
+	DevToolsURL string `yaml:"devToolsURL"`
 }
 
 // ServiceError an error used in client server communication